@@ -0,0 +1,66 @@
+package dbmap
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// CommentProvider returns the key-value pairs of the comment appended to
+// statements executed with ctx, e.g. the route and request ID stored in ctx
+// by HTTP middleware. See DB.CommentProvider.
+type CommentProvider func(ctx context.Context) map[string]string
+
+// commentStatement wraps handler to append the comment of d.CommentProvider
+// to the statement's SQL.
+func (d *DB) commentStatement(handler Handler) Handler {
+	return func(ctx context.Context, stmt *Statement) (Result, error) {
+		if comment := formatComment(d.CommentProvider(ctx)); comment != "" {
+			stmt.SQL = appendComment(stmt.SQL, comment)
+		}
+
+		return handler(ctx, stmt)
+	}
+}
+
+// formatComment formats the pairs as a sqlcommenter comment, e.g.
+// `/*route='%2Fusers',request_id='abc'*/`. Keys are sorted, and keys and values
+// are URL encoded so they can't contain quotes or end the comment.
+func formatComment(pairs map[string]string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var comment strings.Builder
+	comment.WriteString("/*")
+	for i, key := range keys {
+		if i > 0 {
+			comment.WriteString(",")
+		}
+		comment.WriteString(url.PathEscape(key))
+		comment.WriteString("='")
+		comment.WriteString(url.PathEscape(pairs[key]))
+		comment.WriteString("'")
+	}
+	comment.WriteString("*/")
+
+	return comment.String()
+}
+
+// appendComment appends comment to query, before its trailing semicolon if
+// it has one.
+func appendComment(query string, comment string) string {
+	trimmed := strings.TrimRight(query, " \t\r\n")
+	if body, ok := strings.CutSuffix(trimmed, ";"); ok {
+		return body + " " + comment + ";"
+	}
+
+	return trimmed + " " + comment
+}
@@ -0,0 +1,62 @@
+package dbmap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatComment(t *testing.T) {
+	tests := []struct {
+		name     string
+		pairs    map[string]string
+		expected string
+	}{
+		{name: "no pairs", pairs: nil, expected: ""},
+		{name: "sorts keys", pairs: map[string]string{"route": "users", "app": "api"}, expected: "/*app='api',route='users'*/"},
+		{name: "encodes values", pairs: map[string]string{"route": "/users/{id} show"}, expected: "/*route='%2Fusers%2F%7Bid%7D%20show'*/"},
+		{name: "escapes quotes", pairs: map[string]string{"route": "a' OR '1'='1"}, expected: "/*route='a%27%20OR%20%271%27=%271'*/"},
+		{name: "escapes comment terminators", pairs: map[string]string{"route": "*/ DROP TABLE users; /*"}, expected: "/*route='%2A%2F%20DROP%20TABLE%20users%3B%20%2F%2A'*/"},
+		{name: "escapes keys", pairs: map[string]string{"a'b */": "c"}, expected: "/*a%27b%20%2A%2F='c'*/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, formatComment(tt.pairs))
+		})
+	}
+}
+
+func TestAppendComment(t *testing.T) {
+	require.Equal(t, "SELECT 1 /*a='b'*/", appendComment("SELECT 1", "/*a='b'*/"))
+	require.Equal(t, "SELECT 1 /*a='b'*/", appendComment("SELECT 1 \n", "/*a='b'*/"))
+	require.Equal(t, "SELECT 1 /*a='b'*/;", appendComment("SELECT 1;", "/*a='b'*/"))
+}
+
+func TestDB_commentStatement(t *testing.T) {
+	type routeKey struct{}
+
+	db := &DB{CommentProvider: func(ctx context.Context) map[string]string {
+		route, ok := ctx.Value(routeKey{}).(string)
+		if !ok {
+			return nil
+		}
+		return map[string]string{"route": route}
+	}}
+
+	var executed string
+	handler := func(_ context.Context, stmt *Statement) (Result, error) {
+		executed = stmt.SQL
+		return Result{}, nil
+	}
+
+	ctx := context.WithValue(context.Background(), routeKey{}, "GET /users")
+	_, err := db.execute(ctx, &Statement{SQL: "SELECT * FROM users"}, handler)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM users /*route='GET%20%2Fusers'*/", executed)
+
+	_, err = db.execute(context.Background(), &Statement{SQL: "SELECT * FROM users"}, handler)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM users", executed)
+}
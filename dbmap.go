@@ -13,10 +13,14 @@ package dbmap
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"iter"
+	"log/slog"
 	"maps"
 	"reflect"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -26,10 +30,18 @@ import (
 var (
 	// ErrNoUpdates is returned when no updates are provided to an update operation
 	ErrNoUpdates = errors.New("no updates provided")
+
+	// ErrEmptySlice is returned when an empty slice is provided as a named
+	// parameter, since it can't be expanded into a valid `IN` list.
+	ErrEmptySlice = errors.New("empty slice provided for named parameter")
 )
 
 type (
 	// Args is a map of named parameters to their values for SQL queries.
+	//
+	// Methods accepting named parameters also accept a struct, or pointer to a
+	// struct, in place of Args. Parameters are then resolved against the
+	// struct's field names and `db` column names, e.g. `$ID` or `$id`.
 	Args = map[string]any
 
 	// Updates is a map of struct fields to their values for Update* methods
@@ -38,20 +50,78 @@ type (
 	// DB is a wrapper around sql.DB that provides lightweight ORM-like functionality.
 	DB struct {
 		db             queryable
+		tx             *transaction
 		modelTypeCache *sync.Map
 		time           clock
 		// Pluralizer is used to pluralize table names. You can provide your own
 		// pluralizer by overriding this field.
 		Pluralizer Pluralizer
-	}
-
-	// enable using db or tx in the DB struct
+		// Dialect controls identifier quoting, placeholders, and primary key
+		// retrieval for the underlying database. Defaults to MySQL.
+		Dialect Dialect
+		// AllowEmptySlices renders empty slice parameters as NULL instead of
+		// returning ErrEmptySlice, so `IN ($ids)` matches no rows.
+		//
+		// *Warning*: `NOT IN (NULL)` also matches no rows.
+		AllowEmptySlices bool
+		// Interceptors are called around every statement executed by DB, except
+		// for transaction control statements. The first interceptor is the
+		// outermost. See Interceptor.
+		Interceptors []Interceptor
+		// Logger logs every statement executed by DB when set, with its
+		// operation, table, SQL, duration, rows, and named arguments.
+		// Statements are logged at debug level, or error level when they
+		// fail, as they are executed by the database after any interceptors.
+		Logger *slog.Logger
+		// Redactor returns the logged value of a statement argument, e.g. to
+		// mask arguments named `token`. Arguments of columns tagged with the
+		// `sensitive` option, e.g. `db:"password,sensitive"`, are always
+		// redacted and aren't passed to Redactor.
+		Redactor func(arg NamedArg) any
+		// SlowQueryThreshold reports statements taking at least the threshold
+		// to execute using OnSlowQuery. Zero disables slow statement reports.
+		SlowQueryThreshold time.Duration
+		// OnSlowQuery is called for statements exceeding SlowQueryThreshold.
+		// When nil, slow statements are logged at warn level using Logger, or
+		// slog.Default when Logger is nil.
+		OnSlowQuery func(ctx context.Context, query SlowQuery)
+		// Tracer starts spans around every statement and transaction executed
+		// by DB when set. See MemoryTracer for tests.
+		Tracer Tracer
+		// Metrics records every statement executed by DB when set, e.g. using
+		// a MetricsCollector.
+		Metrics Metrics
+		// CommentProvider appends a sqlcommenter comment, e.g.
+		// `/*route='%2Fusers'*/`, to every statement executed by DB when set,
+		// using the key-value pairs it returns for the statement's context.
+		// The comment is added after any interceptors, so it is part of the
+		// SQL that is logged and traced.
+		CommentProvider CommentProvider
+		// RepeatedQueryThreshold reports Select statements with the same
+		// table and query fragment executed more than the threshold times
+		// within a QueryScope, which usually indicates an N+1 query. Zero
+		// disables reports. See WithQueryScope.
+		RepeatedQueryThreshold int
+		// OnRepeatedQuery is called once for each Select statement exceeding
+		// RepeatedQueryThreshold within a QueryScope. When nil, repeated
+		// statements are logged at warn level using Logger, or slog.Default
+		// when Logger is nil.
+		OnRepeatedQuery func(ctx context.Context, query RepeatedQuery)
+	}
+
+	// enable using db, conn, or tx in the DB struct
 	queryable interface {
 		QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
 		QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 		ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
 	}
 
+	// beginner is implemented by queryables that can begin a transaction,
+	// like *sql.DB and *sql.Conn
+	beginner interface {
+		BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	}
+
 	// TableNamer is an interface models can implement to override the default
 	// `snake_case`d, pluralized table name.
 	//
@@ -72,14 +142,66 @@ type (
 
 // New initializes a new DB instance with the provided sql.DB connection.
 func New(db *sql.DB) *DB {
+	return newDB(db)
+}
+
+// NewFromTx initializes a new DB instance executing statements within an
+// existing transaction, e.g. one owned by another library. The caller remains
+// responsible for committing or rolling back tx.
+//
+// Transaction creates a savepoint within tx.
+func NewFromTx(tx *sql.Tx) *DB {
+	return newDB(nil).FromTx(tx)
+}
+
+// NewFromConn initializes a new DB instance executing statements on a single
+// connection, which is needed for session variables, temporary tables, and
+// locks like GET_LOCK. The caller remains responsible for closing conn.
+//
+// Transaction begins a transaction on conn.
+func NewFromConn(conn *sql.Conn) *DB {
+	return newDB(conn)
+}
+
+// FromTx returns a copy of d executing statements within an existing
+// transaction, sharing the model cache and configuration of d. See NewFromTx.
+func (d *DB) FromTx(tx *sql.Tx) *DB {
+	txDB := *d
+	txDB.db = tx
+	txDB.tx = &transaction{source: tx, external: true}
+
+	return &txDB
+}
+
+// FromConn returns a copy of d executing statements on a single connection,
+// sharing the model cache and configuration of d. See NewFromConn.
+func (d *DB) FromConn(conn *sql.Conn) *DB {
+	connDB := *d
+	connDB.db = conn
+	connDB.tx = nil
+
+	return &connDB
+}
+
+// newDB initializes a DB with the default configuration.
+func newDB(db queryable) *DB {
 	return &DB{
 		db:             db,
 		Pluralizer:     defaultPluralizer,
+		Dialect:        MySQL,
 		modelTypeCache: &sync.Map{},
 		time:           realClock{},
 	}
 }
 
+// dialect returns the configured Dialect, falling back to MySQL when unset.
+func (d *DB) dialect() Dialect {
+	if d.Dialect == nil {
+		return MySQL
+	}
+	return d.Dialect
+}
+
 // newModelType creates a new modelType for the given destination
 func (d *DB) newModelType(model any) (*modelType, error) {
 	key := reflect.TypeOf(model)
@@ -108,70 +230,199 @@ func (d *DB) Close() error {
 }
 
 // Select executes a query and scans the result into the provided model struct or slice of structs.
-func (d *DB) Select(ctx context.Context, model any, queryFragment string, args Args) error {
+// ErrNotFound is returned when scanning into a struct and no row matches.
+func (d *DB) Select(ctx context.Context, model any, queryFragment string, args any) error {
+	d = d.contextDB(ctx)
+
 	modelType, err := d.newModelType(model)
 	if err != nil {
 		return fmt.Errorf("failed to select data: %w", err)
 	}
 
-	fragment, queryArgs, err := d.replaceNames(queryFragment, args)
+	if !modelType.isValidSlice && !modelType.isStructPointer {
+		return fmt.Errorf("expected a pointer to a slice, or a struct, got %s", reflect.TypeOf(model).String())
+	}
+
+	fragment, vars, err := d.bindQuery(queryFragment, args)
 	if err != nil {
 		return fmt.Errorf("failed to prepare query: %w", err)
 	}
 	selectFragment, structFields := d.generateSelect(modelType)
 	query := selectFragment + " " + fragment
-	rows, err := d.db.QueryContext(ctx, query, queryArgs...)
-	if err != nil {
-		return fmt.Errorf("failed to execute Select query: %w", err)
-	}
-	defer rows.Close()
-
-	if !modelType.isValidSlice && !modelType.isStructPointer {
-		return fmt.Errorf("expected a pointer to a slice, or a struct, got %s", reflect.TypeOf(model).String())
-	}
 
 	rootType := reflect.TypeOf(model)
 	isSlice := rootType.Kind() == reflect.Slice || rootType.Kind() == reflect.Pointer && rootType.Elem().Kind() == reflect.Slice
 
-	if rows.Err() != nil {
-		return fmt.Errorf("error occurred during row iteration: %w", rows.Err())
-	}
+	// A struct without a matching row isn't a failed statement, so
+	// ErrNotFound is returned once the statement has been executed.
+	notFound := false
+	stmt := newStatement(OpSelect, modelType, queryFragment, query, vars)
+	_, err = d.execute(ctx, stmt, func(ctx context.Context, stmt *Statement) (Result, error) {
+		rows, err := d.db.QueryContext(ctx, stmt.SQL, stmt.Args...)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to execute Select query: %w", err)
+		}
+		defer rows.Close()
 
-	if isSlice {
-		sliceTarget := reflect.ValueOf(model).Elem()
+		if isSlice {
+			sliceTarget := reflect.ValueOf(model).Elem()
 
-		for rows.Next() {
-			row := reflect.New(modelType.elemType).Elem()
-			if err := scanStruct(structFields, rows, row); err != nil {
-				return fmt.Errorf("failed to scan row: %w", err)
-			}
+			for rows.Next() {
+				row := reflect.New(modelType.elemType).Elem()
+				if err := scanStruct(structFields, rows, row); err != nil {
+					return Result{}, fmt.Errorf("failed to scan row: %w", err)
+				}
 
-			if modelType.isSliceOfPointers {
-				row = row.Addr()
+				if modelType.isSliceOfPointers {
+					row = row.Addr()
+				}
+
+				sliceTarget = reflect.Append(sliceTarget, row)
+			}
+			if err := rows.Err(); err != nil {
+				return Result{}, fmt.Errorf("error occurred during row iteration: %w", err)
 			}
 
-			sliceTarget = reflect.Append(sliceTarget, row)
-		}
+			reflect.ValueOf(model).Elem().Set(sliceTarget)
 
-		reflect.ValueOf(model).Elem().Set(sliceTarget)
-	} else {
-		row := concreteValue(model)
+			return Result{RowsReturned: int64(sliceTarget.Len())}, nil
+		}
 
 		// rows.Next() must be called to advance to the first row and check if
-		// we actually have results, otherwise return sql.ErrNoRows
+		// we actually have results
 		if !rows.Next() {
-			return sql.ErrNoRows
+			if err := rows.Err(); err != nil {
+				return Result{}, fmt.Errorf("error occurred during row iteration: %w", err)
+			}
+			notFound = true
+			return Result{}, nil
 		}
-		if err := scanStruct(structFields, rows, row); err != nil {
-			return fmt.Errorf("failed to scan row: %w", err)
+		if err := scanStruct(structFields, rows, concreteValue(model)); err != nil {
+			return Result{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		return Result{RowsReturned: 1}, nil
+	})
+	if err != nil {
+		return err
+	}
+	if notFound {
+		return ErrNotFound
+	}
+
+	// Hooks are called once the rows are closed, since they may query the
+	// database, which a transaction's connection can't do while rows are open.
+	if !modelType.hooks.afterFind {
+		return nil
+	}
+
+	if !isSlice {
+		return d.afterFind(ctx, modelType, concreteValue(model))
+	}
+
+	sliceTarget := concreteValue(model)
+	for i := range sliceTarget.Len() {
+		row := sliceTarget.Index(i)
+		if modelType.isSliceOfPointers {
+			row = row.Elem()
+		}
+
+		if err := d.afterFind(ctx, modelType, row); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
+// SelectIter executes a query and returns an iterator that scans each row into
+// a new T as it is read, instead of loading the full result into memory like
+// Select. The rows are closed when iteration finishes or the loop exits early.
+//
+// Errors are yielded with a nil *T and end the iteration:
+//
+//	for user, err := range dbmap.SelectIter[User](ctx, db, "WHERE active = $active", dbmap.Args{"active": true}) {
+//		if err != nil {
+//			return err
+//		}
+//		// ...
+//	}
+//
+// Rows are read while the statement runs through DB.Interceptors and tracing
+// spans, so those include the time spent by the loop. The durations logged,
+// reported as slow, and recorded in metrics exclude it.
+func SelectIter[T any](ctx context.Context, d *DB, queryFragment string, args any) iter.Seq2[*T, error] {
+	d = d.contextDB(ctx)
+
+	return func(yield func(*T, error) bool) {
+		modelType, err := d.newModelType(new(T))
+		if err != nil {
+			yield(nil, fmt.Errorf("failed to select data: %w", err))
+			return
+		}
+
+		if modelType.elemType != reflect.TypeFor[T]() {
+			yield(nil, fmt.Errorf("expected a struct type, got %s", modelType.baseType.Elem().String()))
+			return
+		}
+
+		fragment, vars, err := d.bindQuery(queryFragment, args)
+		if err != nil {
+			yield(nil, fmt.Errorf("failed to prepare query: %w", err))
+			return
+		}
+		selectFragment, structFields := d.generateSelect(modelType)
+		query := selectFragment + " " + fragment
+
+		// Rows are yielded within the handler, so interceptors observe the
+		// full iteration. The time spent by the caller's loop is recorded on
+		// the statement so it's excluded from its duration.
+		stopped := false
+		stmt := newStatement(OpSelect, modelType, queryFragment, query, vars)
+		_, err = d.execute(ctx, stmt, func(ctx context.Context, stmt *Statement) (Result, error) {
+			rows, err := d.db.QueryContext(ctx, stmt.SQL, stmt.Args...)
+			if err != nil {
+				return Result{}, fmt.Errorf("failed to execute Select query: %w", err)
+			}
+			defer rows.Close()
+
+			var n int64
+			for rows.Next() {
+				row := new(T)
+				if err := scanStruct(structFields, rows, reflect.ValueOf(row).Elem()); err != nil {
+					return Result{RowsReturned: n}, fmt.Errorf("failed to scan row: %w", err)
+				}
+				n++
+				if err := d.afterFind(ctx, modelType, reflect.ValueOf(row).Elem()); err != nil {
+					return Result{RowsReturned: n}, err
+				}
+
+				yieldStart := time.Now()
+				more := yield(row, nil)
+				stmt.consumerTime += time.Since(yieldStart)
+				if !more {
+					stopped = true
+					return Result{RowsReturned: n}, nil
+				}
+			}
+
+			if err := rows.Err(); err != nil {
+				return Result{RowsReturned: n}, fmt.Errorf("error occurred during row iteration: %w", err)
+			}
+
+			return Result{RowsReturned: n}, nil
+		})
+
+		if err != nil && !stopped {
+			yield(nil, err)
+		}
+	}
+}
+
 // InsertRecord inserts a new record into the database based on the provided struct.
 func (d *DB) InsertRecord(ctx context.Context, model any) error {
+	d = d.contextDB(ctx)
+
 	modelType, err := d.newModelType(model)
 	if err != nil {
 		return fmt.Errorf("failed to insert data: %w", err)
@@ -180,55 +431,473 @@ func (d *DB) InsertRecord(ctx context.Context, model any) error {
 		return fmt.Errorf("destination must be a pointer to a struct, got %s", modelType.baseType.Kind())
 	}
 
-	var insertColumns strings.Builder
-	insertColumnData := make([]any, 0, modelType.numField)
-	var insertValuePlaceholders strings.Builder
+	value := concreteValue(model)
+	now := d.time.Now().UTC()
+	touchTimestamp(value, modelType.createdAtFieldIndex, now)
+	touchTimestamp(value, modelType.updatedAtFieldIndex, now)
+
+	if !modelType.hooks.beforeInsert && !modelType.hooks.afterInsert {
+		if err := d.validate(ctx, modelType, value); err != nil {
+			return err
+		}
+		return d.insertBatch(ctx, modelType, []reflect.Value{value})
+	}
+
+	// Hooks run in a transaction so they can make changes atomically with
+	// the insert, and AfterInsert errors roll it back. The record is
+	// validated after BeforeInsert, so hooks can set validated fields.
+	return d.Transaction(ctx, func(tx *DB) error {
+		if err := tx.beforeInsert(ctx, modelType, value); err != nil {
+			return err
+		}
+		if err := tx.validate(ctx, modelType, value); err != nil {
+			return err
+		}
+		if err := tx.insertBatch(ctx, modelType, []reflect.Value{value}); err != nil {
+			return err
+		}
+		return tx.afterInsert(ctx, modelType, value)
+	})
+}
+
+// InsertRecords inserts multiple records into the database based on the
+// provided slice of structs or slice of pointers to structs. Like
+// InsertRecord, timestamps are set and generated IDs are populated on each
+// element.
+//
+// Records are inserted using multi-row INSERT statements inside of a
+// transaction, using as few statements as the dialect's placeholder limit
+// allows. For dialects using the LastInsertID strategy, IDs are populated
+// assuming MySQL semantics, where a multi-row INSERT generates consecutive IDs
+// starting at LastInsertId. This requires auto_increment_increment to be 1,
+// its default; setups raising it, like Galera or multi-primary replication,
+// get wrong IDs for every record after the first, and should insert records
+// one at a time using InsertRecord instead. For dialects using the Returning strategy, the
+// returned rows are matched to records by position, so dialects without
+// OrderedReturning, like SQLite, insert one record per statement.
+func (d *DB) InsertRecords(ctx context.Context, models any) error {
+	d = d.contextDB(ctx)
+
+	modelType, err := d.newModelType(models)
+	if err != nil {
+		return fmt.Errorf("failed to insert data: %w", err)
+	}
+	if !modelType.isValidSlice {
+		return fmt.Errorf("destination must be a slice, got %s", modelType.baseType.Kind())
+	}
+
+	sliceValue := concreteValue(models)
+	if sliceValue.Len() == 0 {
+		return nil
+	}
+
+	now := d.time.Now().UTC()
+	values := make([]reflect.Value, 0, sliceValue.Len())
+	for i := range sliceValue.Len() {
+		value := sliceValue.Index(i)
+		if modelType.isSliceOfPointers {
+			if value.IsNil() {
+				return fmt.Errorf("cannot insert nil record at index %d", i)
+			}
+			value = value.Elem()
+		}
+
+		touchTimestamp(value, modelType.createdAtFieldIndex, now)
+		touchTimestamp(value, modelType.updatedAtFieldIndex, now)
+		values = append(values, value)
+	}
+
+	return d.Transaction(ctx, func(tx *DB) error {
+		if err := tx.beforeInsert(ctx, modelType, values...); err != nil {
+			return err
+		}
+		for i, value := range values {
+			if err := tx.validate(ctx, modelType, value); err != nil {
+				return fmt.Errorf("invalid record at index %d: %w", i, err)
+			}
+		}
+		for _, batch := range tx.insertBatches(modelType, values) {
+			if err := tx.insertBatch(ctx, modelType, batch); err != nil {
+				return err
+			}
+		}
+		return tx.afterInsert(ctx, modelType, values...)
+	})
+}
+
+// Upsert inserts the provided struct, or updates the existing row when the
+// insert conflicts with it. The model parameter should be a pointer to a
+// struct.
+//
+// The conflict parameter lists the unique columns that identify an existing
+// row, and update lists the columns to overwrite with the struct's values. Both
+// accept struct field names or column names. MySQL ignores the conflict columns
+// and uses any unique index instead.
+//
+// The `created_at` column is preserved when updating, and the preserved value
+// is read back into the struct, while `updated_at` is always touched.
+// Generated IDs are populated like InsertRecord. Dialects that need more than
+// one statement run them in a transaction.
+//
+// It returns true when the row was inserted, or false when it was updated.
+func (d *DB) Upsert(ctx context.Context, model any, conflict []string, update []string) (bool, error) {
+	d = d.contextDB(ctx)
+
+	modelType, err := d.newModelType(model)
+	if err != nil {
+		return false, fmt.Errorf("failed to upsert data: %w", err)
+	}
+	if !modelType.isStructPointer {
+		return false, fmt.Errorf("destination must be a pointer to a struct, got %s", modelType.baseType.Kind())
+	}
+
+	conflictColumns, err := modelType.columnNames(conflict)
+	if err != nil {
+		return false, fmt.Errorf("invalid conflict columns: %w", err)
+	}
+
+	updateFields := update
+	if modelType.updatedAtFieldIndex >= 0 {
+		updateFields = append(slices.Clone(update), modelType.elemType.Field(modelType.updatedAtFieldIndex).Name)
+	}
+	updateColumns, err := modelType.columnNames(updateFields)
+	if err != nil {
+		return false, fmt.Errorf("invalid update columns: %w", err)
+	}
+	slices.Sort(updateColumns)
+	updateColumns = slices.Compact(updateColumns)
+
+	// created_at is only set when the row is inserted
+	var createdAt string
+	if modelType.createdAtFieldIndex >= 0 {
+		createdAt = columnName(modelType.elemType.Field(modelType.createdAtFieldIndex))
+	}
+	updateColumns = slices.DeleteFunc(updateColumns, func(name string) bool { return name == createdAt })
+
+	if len(updateColumns) == 0 {
+		return false, ErrNoUpdates
+	}
 
 	value := concreteValue(model)
 	now := d.time.Now().UTC()
 	touchTimestamp(value, modelType.createdAtFieldIndex, now)
 	touchTimestamp(value, modelType.updatedAtFieldIndex, now)
 
-	for _, col := range modelType.columns {
-		fieldValue := value.FieldByName(col.Name)
+	// Only integer IDs are passed to the dialect, since MySQL makes them
+	// retrievable using LAST_INSERT_ID, which converts its argument to an
+	// integer.
+	idColumn := modelType.integerIDColumn()
+
+	dialect := d.dialect()
+	switch dialect.UpsertStrategy() {
+	case AffectedRows:
+		clause := dialect.Upsert(idColumn, conflictColumns, updateColumns)
+		if modelType.createdAtFieldIndex < 0 || len(modelType.primaryKey) == 0 {
+			return d.upsertAffectedRows(ctx, modelType, value, clause)
+		}
 
-		columnName := col.Tag.Get("db")
-		if columnName == "" {
-			columnName = snake_case(col.Name)
+		// Updated rows keep their created_at, so read it back like the
+		// RETURNING clause of other strategies does.
+		var inserted bool
+		err := d.Transaction(ctx, func(tx *DB) error {
+			var err error
+			inserted, err = tx.upsertAffectedRows(ctx, modelType, value, clause)
+			if err != nil || inserted {
+				return err
+			}
+
+			return tx.reloadCreatedAt(ctx, modelType, value)
+		})
+
+		return inserted, err
+	case ReturningXmax:
+		if len(conflictColumns) == 0 {
+			return false, fmt.Errorf("conflict columns are required for %s upserts", dialect.Name())
 		}
 
-		if insertColumns.Len() > 0 {
-			insertColumns.WriteString(", ")
-			insertValuePlaceholders.WriteString(", ")
+		clause := dialect.Upsert(idColumn, conflictColumns, updateColumns)
+		return d.upsertReturningXmax(ctx, modelType, value, clause, d.upsertReturningColumns(modelType))
+	case DoNothingFirst:
+		if len(conflictColumns) == 0 {
+			return false, fmt.Errorf("conflict columns are required for %s upserts", dialect.Name())
+		}
+
+		// Both statements run in a transaction, so a row deleted between
+		// them isn't inserted by the second and reported as updated.
+		returning := d.upsertReturningColumns(modelType)
+		var inserted bool
+		err := d.Transaction(ctx, func(tx *DB) error {
+			var err error
+			clause := dialect.Upsert(idColumn, conflictColumns, nil)
+			inserted, err = tx.execUpsert(ctx, modelType, value, clause, returning)
+			if err != nil || inserted {
+				return err
+			}
+
+			clause = dialect.Upsert(idColumn, conflictColumns, updateColumns)
+			_, err = tx.execUpsert(ctx, modelType, value, clause, returning)
+			return err
+		})
+
+		return inserted, err
+	default:
+		return false, fmt.Errorf("unsupported upsert strategy: %d", dialect.UpsertStrategy())
+	}
+}
+
+// upsertReturningColumns returns the columns returned by upserts, which
+// include created_at so updated rows reflect the preserved value, even when
+// the model has no generated columns.
+func (d *DB) upsertReturningColumns(model *modelType) []column {
+	returning := d.returningColumns(model)
+
+	dialect := d.dialect()
+	supportsReturning := dialect.IDStrategy() == Returning || dialect.UpsertStrategy() == ReturningXmax
+	if model.createdAtFieldIndex >= 0 && supportsReturning {
+		returning = append(slices.Clone(returning), column{
+			StructField: model.elemType.Field(model.createdAtFieldIndex),
+			name:        columnName(model.elemType.Field(model.createdAtFieldIndex)),
+		})
+	}
+
+	return returning
+}
+
+// upsertAffectedRows executes an upsert statement with the given clause,
+// using the rows affected to determine whether the row was inserted.
+func (d *DB) upsertAffectedRows(ctx context.Context, model *modelType, value reflect.Value, clause string) (bool, error) {
+	insertSQL, insertVars, _ := d.buildInsert(model, []reflect.Value{value}, clause, nil)
+
+	res, err := d.exec(ctx, newStatement(OpInsert, model, "", insertSQL, insertVars))
+	if err != nil {
+		return false, fmt.Errorf("failed to execute upsert: %w", err)
+	}
+
+	// Inserted rows are reported as 1 affected row, updated rows as 2, and
+	// unchanged rows as 0.
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+
+	if idField, ok := d.findIDField(value, model); ok && idField.IsZero() {
+		id, err := res.LastInsertId()
+		if err != nil {
+			return false, fmt.Errorf("failed to retrieve last insert ID: %w", err)
+		}
+		setID(idField, id)
+	}
+
+	return n == 1, nil
+}
+
+// reloadCreatedAt reads the created_at column of the row of value, by primary
+// key, into value. value is left as is when the row doesn't exist.
+func (d *DB) reloadCreatedAt(ctx context.Context, model *modelType, value reflect.Value) error {
+	createdAt := model.elemType.Field(model.createdAtFieldIndex)
+	vars := d.newBindVars(len(model.primaryKey))
+	selectSQL := fmt.Sprintf("SELECT %s FROM %s WHERE %s", d.dialect().Quote(columnName(createdAt)), model.tableName, d.primaryKeyCondition(model, vars, value))
+
+	_, err := d.execute(ctx, newStatement(OpSelect, model, "", selectSQL, vars), func(ctx context.Context, stmt *Statement) (Result, error) {
+		rows, err := d.db.QueryContext(ctx, stmt.SQL, stmt.Args...)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to execute Select query: %w", err)
+		}
+		defer rows.Close()
+
+		if !rows.Next() {
+			return Result{}, rows.Err()
+		}
+		if err := scanStruct([]string{createdAt.Name}, rows, value); err != nil {
+			return Result{}, err
+		}
+
+		return Result{RowsReturned: 1}, rows.Err()
+	})
+
+	return err
+}
+
+// upsertReturningXmax executes an upsert statement with the given clause,
+// scanning the returned columns into value. The statement also returns
+// whether xmax is 0, which is only true for rows it inserted, since updated
+// rows are locked by the updating transaction.
+func (d *DB) upsertReturningXmax(ctx context.Context, model *modelType, value reflect.Value, clause string, returning []column) (bool, error) {
+	insertSQL, insertVars, returningFields := d.buildInsert(model, []reflect.Value{value}, clause, returning)
+	if len(returningFields) > 0 {
+		insertSQL += ", (xmax = 0)"
+	} else {
+		insertSQL += " RETURNING (xmax = 0)"
+	}
+
+	var inserted bool
+	_, err := d.execute(ctx, newStatement(OpInsert, model, "", insertSQL, insertVars), func(ctx context.Context, stmt *Statement) (Result, error) {
+		rows, err := d.db.QueryContext(ctx, stmt.SQL, stmt.Args...)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to execute upsert: %w", err)
+		}
+		defer rows.Close()
+
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return Result{}, fmt.Errorf("failed to execute upsert: %w", err)
+			}
+			return Result{}, fmt.Errorf("upsert did not return a row")
+		}
+
+		scanArgs := make([]any, 0, len(returningFields)+1)
+		for _, fieldName := range returningFields {
+			scanArgs = append(scanArgs, value.FieldByName(fieldName).Addr().Interface())
+		}
+		if err := rows.Scan(append(scanArgs, &inserted)...); err != nil {
+			return Result{}, fmt.Errorf("failed to scan generated values: %w", err)
+		}
+
+		return Result{RowsAffected: 1, RowsReturned: 1}, rows.Err()
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return inserted, nil
+}
+
+// execUpsert executes an INSERT statement with the given conflict clause,
+// scanning any returned columns into value. It returns true when a row was
+// inserted or updated by the statement.
+func (d *DB) execUpsert(ctx context.Context, model *modelType, value reflect.Value, clause string, returning []column) (bool, error) {
+	insertSQL, insertVars, returningFields := d.buildInsert(model, []reflect.Value{value}, clause, returning)
+
+	stmt := newStatement(OpInsert, model, "", insertSQL, insertVars)
+
+	if len(returningFields) == 0 {
+		res, err := d.exec(ctx, stmt)
+		if err != nil {
+			return false, fmt.Errorf("failed to execute upsert: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return false, fmt.Errorf("failed to retrieve rows affected: %w", err)
+		}
+
+		return n > 0, nil
+	}
+
+	result, err := d.execute(ctx, stmt, func(ctx context.Context, stmt *Statement) (Result, error) {
+		rows, err := d.db.QueryContext(ctx, stmt.SQL, stmt.Args...)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to execute upsert: %w", err)
+		}
+		defer rows.Close()
+
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return Result{}, fmt.Errorf("failed to execute upsert: %w", err)
+			}
+			return Result{}, nil
+		}
+		if err := scanStruct(returningFields, rows, value); err != nil {
+			return Result{}, fmt.Errorf("failed to scan generated values: %w", err)
+		}
+
+		return Result{RowsAffected: 1, RowsReturned: 1}, rows.Err()
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// insertBatches groups values into batches that can be inserted with a single
+// statement. Consecutive values are batched together when they insert the same
+// columns, up to the dialect's placeholder limit. When generated values are
+// returned by a dialect that doesn't return rows in order, each value is
+// inserted on its own so returned rows can't be assigned to the wrong record.
+func (d *DB) insertBatches(model *modelType, values []reflect.Value) [][]reflect.Value {
+	var batches [][]reflect.Value
+	var batchColumns []column
+
+	unordered := len(d.returningColumns(model)) > 0 && !d.dialect().OrderedReturning()
+
+	for _, value := range values {
+		columns := insertColumns(model, value)
+		maxRows := max(d.dialect().MaxPlaceholders()/max(len(columns), 1), 1)
+		if unordered {
+			maxRows = 1
+		}
+
+		last := len(batches) - 1
+		if last >= 0 && len(batches[last]) < maxRows && slices.EqualFunc(columns, batchColumns, func(a, b column) bool { return a.name == b.name }) {
+			batches[last] = append(batches[last], value)
+			continue
 		}
-		insertColumns.WriteString("`" + columnName + "`")
-		insertColumnData = append(insertColumnData, fieldValue.Interface())
-		insertValuePlaceholders.WriteString("?")
+
+		batches = append(batches, []reflect.Value{value})
+		batchColumns = columns
 	}
 
-	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", modelType.tableName, insertColumns.String(), insertValuePlaceholders.String())
+	return batches
+}
+
+// insertBatch inserts values using a single statement and populates their
+// generated IDs and `default` columns.
+func (d *DB) insertBatch(ctx context.Context, model *modelType, values []reflect.Value) error {
+	insertSQL, insertVars, returningFields := d.generateInsert(model, values...)
+
+	// Generated values are returned by the insert statement itself, so scan
+	// them directly into the structs.
+	stmt := newStatement(OpInsert, model, "", insertSQL, insertVars)
+
+	if len(returningFields) > 0 {
+		_, err := d.execute(ctx, stmt, func(ctx context.Context, stmt *Statement) (Result, error) {
+			rows, err := d.db.QueryContext(ctx, stmt.SQL, stmt.Args...)
+			if err != nil {
+				return Result{}, fmt.Errorf("failed to execute insert: %w", err)
+			}
+			defer rows.Close()
+
+			for i, value := range values {
+				if !rows.Next() {
+					if err := rows.Err(); err != nil {
+						return Result{}, fmt.Errorf("failed to execute insert: %w", err)
+					}
+					return Result{RowsAffected: int64(i), RowsReturned: int64(i)}, fmt.Errorf("insert did not return generated values")
+				}
+				if err := scanStruct(returningFields, rows, value); err != nil {
+					return Result{}, fmt.Errorf("failed to scan generated values: %w", err)
+				}
+			}
+
+			n := int64(len(values))
+			return Result{RowsAffected: n, RowsReturned: n}, rows.Err()
+		})
+
+		return err
+	}
 
-	res, err := d.db.ExecContext(ctx, insertSQL, insertColumnData...)
+	res, err := d.exec(ctx, stmt)
 	if err != nil {
 		return fmt.Errorf("failed to execute insert: %w", err)
 	}
 
+	// Batches share the same columns, so if the first value provided its own
+	// ID there is nothing to populate.
+	idField, ok := d.findIDField(values[0], model)
+	if !ok || !idField.IsZero() {
+		return nil
+	}
+
 	id, err := res.LastInsertId()
 	if err != nil {
 		return fmt.Errorf("failed to retrieve last insert ID: %w", err)
 	}
 
-	// Attempt to set the ID field if it exists
-	idField, ok := d.findIDField(concreteValue(model), modelType)
-	if ok && idField.IsValid() && idField.CanSet() {
-		switch idField.Kind() {
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			idField.SetInt(id)
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			if id >= 0 {
-				idField.SetUint(uint64(id))
-			}
-		}
+	// IDs are consecutive as long as auto_increment_increment is 1, see
+	// InsertRecords.
+	for i, value := range values {
+		idField, _ := d.findIDField(value, model)
+		setID(idField, id+int64(i))
 	}
 
 	return nil
@@ -239,20 +908,22 @@ func (d *DB) InsertRecord(ctx context.Context, model any) error {
 // pointer to a struct type representing the table to delete from.
 //
 // It returns the number of rows affected
-func (d *DB) Delete(ctx context.Context, modelRef any, queryFragment string, args Args) (int64, error) {
+func (d *DB) Delete(ctx context.Context, modelRef any, queryFragment string, args any) (int64, error) {
+	d = d.contextDB(ctx)
+
 	modelType, err := d.newModelType(modelRef)
 	if err != nil {
 		return 0, fmt.Errorf("failed to delete data: %w", err)
 	}
 
-	fragment, queryArgs, err := d.replaceNames(queryFragment, args)
+	fragment, vars, err := d.bindQuery(queryFragment, args)
 
 	if err != nil {
 		return 0, fmt.Errorf("failed to prepare delete query: %w", err)
 	}
 
 	deleteSQL := fmt.Sprintf("DELETE FROM %s %s", modelType.tableName, fragment)
-	res, err := d.db.ExecContext(ctx, deleteSQL, queryArgs...)
+	res, err := d.exec(ctx, newStatement(OpDelete, modelType, queryFragment, deleteSQL, vars))
 	if err != nil {
 		return 0, fmt.Errorf("failed to execute delete: %w", err)
 	}
@@ -266,12 +937,15 @@ func (d *DB) Delete(ctx context.Context, modelRef any, queryFragment string, arg
 
 // DeleteRecords deletes multiple records from the database based on the
 // provided slice of structs.  The dest parameter should be a pointer to a slice
-// of structs representing the records to delete. It deletes each record by its
-// ID inside of a transaction.  If you need to delete in a single statement, use
-// `DB.Delete`.
+// of structs representing the records to delete. It deletes the records by
+// their primary key, in as few statements as the dialect's placeholder limit
+// allows, inside of a transaction.  If you need to delete by arbitrary
+// conditions, use `DB.Delete`.
 //
 // It returns the number of rows affected, or an error if the operation fails.
 func (d *DB) DeleteRecords(ctx context.Context, models any) (int64, error) {
+	d = d.contextDB(ctx)
+
 	modelType, err := d.newModelType(models)
 	if err != nil {
 		return 0, fmt.Errorf("failed to delete data: %w", err)
@@ -281,32 +955,49 @@ func (d *DB) DeleteRecords(ctx context.Context, models any) (int64, error) {
 		return 0, fmt.Errorf("destination must be a slice, got %s", modelType.baseType.Kind())
 	}
 
+	if len(modelType.primaryKey) == 0 {
+		return 0, fmt.Errorf("struct does not have an ID field")
+	}
+
 	destValue := concreteValue(models)
+	values := make([]reflect.Value, 0, destValue.Len())
+	for i := range destValue.Len() {
+		value := destValue.Index(i)
+		if modelType.isSliceOfPointers {
+			if value.IsNil() {
+				return 0, fmt.Errorf("cannot delete nil record at index %d", i)
+			}
+			value = value.Elem()
+		}
+		values = append(values, value)
+	}
+
+	if len(values) == 0 {
+		return 0, nil
+	}
 
 	n := int64(0)
 	err = d.Transaction(ctx, func(tx *DB) error {
-		// For []*T, items are already pointers so we can pass them directly
-		if modelType.isSliceOfPointers {
-			for i := range destValue.Len() {
-				item := destValue.Index(i).Interface()
-				nn, err := tx.DeleteRecord(ctx, item)
-				if err != nil {
-					return err
-				}
-				n += nn
+		if err := tx.beforeDelete(ctx, modelType, values...); err != nil {
+			return err
+		}
+
+		batchSize := max(tx.dialect().MaxPlaceholders()/len(modelType.primaryKey), 1)
+
+		for batch := range slices.Chunk(values, batchSize) {
+			vars := tx.newBindVars(len(batch) * len(modelType.primaryKey))
+			deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE %s", modelType.tableName, tx.primaryKeyCondition(modelType, vars, batch...))
+
+			res, err := tx.exec(ctx, newStatement(OpDelete, modelType, "", deleteSQL, vars))
+			if err != nil {
+				return fmt.Errorf("failed to execute delete: %w", err)
 			}
-		} else {
-			for i := range destValue.Len() {
-				item := destValue.Index(i)
-				addressableItem := reflect.New(item.Type())
-				addressableItem.Elem().Set(item)
 
-				nn, err := tx.DeleteRecord(ctx, addressableItem.Interface())
-				if err != nil {
-					return err
-				}
-				n += nn
+			nn, err := res.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("failed to retrieve rows affected: %w", err)
 			}
+			n += nn
 		}
 		return nil
 	})
@@ -323,6 +1014,8 @@ func (d *DB) DeleteRecords(ctx context.Context, models any) (int64, error) {
 //
 // It returns the number of rows affected, or an error if the operation fails.
 func (d *DB) DeleteRecord(ctx context.Context, model any) (int64, error) {
+	d = d.contextDB(ctx)
+
 	modelType, err := d.newModelType(model)
 
 	if err != nil {
@@ -333,13 +1026,34 @@ func (d *DB) DeleteRecord(ctx context.Context, model any) (int64, error) {
 		return 0, fmt.Errorf("destination must be a pointer to a struct, got %s", modelType.baseType.Kind())
 	}
 
-	deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE id = ?", modelType.tableName)
-	idField, ok := d.findIDField(concreteValue(model), modelType)
-	if !ok {
+	if len(modelType.primaryKey) == 0 {
 		return 0, fmt.Errorf("struct does not have an ID field")
 	}
 
-	res, err := d.db.ExecContext(ctx, deleteSQL, idField.Interface())
+	value := concreteValue(model)
+	if !modelType.hooks.beforeDelete {
+		return d.deleteRecord(ctx, modelType, value)
+	}
+
+	var n int64
+	err = d.Transaction(ctx, func(tx *DB) error {
+		if err := tx.beforeDelete(ctx, modelType, value); err != nil {
+			return err
+		}
+
+		n, err = tx.deleteRecord(ctx, modelType, value)
+		return err
+	})
+
+	return n, err
+}
+
+// deleteRecord deletes the row of value by primary key.
+func (d *DB) deleteRecord(ctx context.Context, modelType *modelType, value reflect.Value) (int64, error) {
+	vars := d.newBindVars(len(modelType.primaryKey))
+	deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE %s", modelType.tableName, d.primaryKeyCondition(modelType, vars, value))
+
+	res, err := d.exec(ctx, newStatement(OpDelete, modelType, "", deleteSQL, vars))
 	if err != nil {
 		return 0, fmt.Errorf("failed to execute delete: %w", err)
 	}
@@ -352,6 +1066,47 @@ func (d *DB) DeleteRecord(ctx context.Context, model any) (int64, error) {
 	return n, nil
 }
 
+// primaryKeyCondition creates a condition matching the primary key of the
+// struct values, adding their primary key values to vars. A single value is
+// matched using `a = ? AND b = ?`, while multiple values are matched using
+// `a IN (?, ?)`, or `(a, b) IN ((?, ?), (?, ?))` for composite primary keys.
+func (d *DB) primaryKeyCondition(model *modelType, vars *bindVars, values ...reflect.Value) string {
+	dialect := d.dialect()
+
+	if len(values) == 1 {
+		conditions := make([]string, 0, len(model.primaryKey))
+		for _, col := range model.primaryKey {
+			conditions = append(conditions, fmt.Sprintf("%s = %s", dialect.Quote(col.name), vars.add(col.name, values[0].FieldByIndex(col.Index).Interface())))
+		}
+		return strings.Join(conditions, " AND ")
+	}
+
+	columns := make([]string, 0, len(model.primaryKey))
+	for _, col := range model.primaryKey {
+		columns = append(columns, dialect.Quote(col.name))
+	}
+
+	tuples := make([]string, 0, len(values))
+	for _, value := range values {
+		placeholders := make([]string, 0, len(model.primaryKey))
+		for _, col := range model.primaryKey {
+			placeholders = append(placeholders, vars.add(col.name, value.FieldByIndex(col.Index).Interface()))
+		}
+
+		if len(placeholders) == 1 {
+			tuples = append(tuples, placeholders[0])
+		} else {
+			tuples = append(tuples, "("+strings.Join(placeholders, ", ")+")")
+		}
+	}
+
+	if len(columns) == 1 {
+		return fmt.Sprintf("%s IN (%s)", columns[0], strings.Join(tuples, ", "))
+	}
+
+	return fmt.Sprintf("(%s) IN (%s)", strings.Join(columns, ", "), strings.Join(tuples, ", "))
+}
+
 func (d *DB) findIDField(destValue reflect.Value, model *modelType) (reflect.Value, bool) {
 	if model.idFieldIndex < 0 {
 		return reflect.Value{}, false
@@ -366,7 +1121,9 @@ func (d *DB) findIDField(destValue reflect.Value, model *modelType) (reflect.Val
 // the table to update.
 //
 // It returns the number of rows affected, or an error if the operation fails.
-func (d *DB) Update(ctx context.Context, structType any, queryFragment string, args Args, updates Updates) (int64, error) {
+func (d *DB) Update(ctx context.Context, structType any, queryFragment string, args any, updates Updates) (int64, error) {
+	d = d.contextDB(ctx)
+
 	modelType, err := d.newModelType(structType)
 	if err != nil {
 		return 0, fmt.Errorf("failed to update data: %w", err)
@@ -396,34 +1153,27 @@ func (d *DB) Update(ctx context.Context, structType any, queryFragment string, a
 	}
 
 	var setClauses strings.Builder
-	updateValues := make([]any, 0, len(updates))
+	vars := d.newBindVars(len(updates))
 
 	for _, col := range modelType.columns {
 		if _, ok := updates[col.Name]; !ok {
 			continue
 		}
 
-		name := col.Tag.Get("db")
-		if name == "" {
-			name = snake_case(col.Name)
-		}
-
 		if setClauses.Len() > 0 {
 			setClauses.WriteString(", ")
 		}
-		setClauses.WriteString(fmt.Sprintf("`%s` = ?", name))
-		updateValues = append(updateValues, updates[col.Name])
+		setClauses.WriteString(fmt.Sprintf("%s = %s", d.dialect().Quote(col.name), vars.add(col.name, updates[col.Name])))
 	}
 
-	fragment, whereArgs, err := d.replaceNames(queryFragment, args)
+	fragment, err := d.bindNames(vars, queryFragment, args)
 	if err != nil {
 		return 0, fmt.Errorf("failed to prepare update query: %w", err)
 	}
 
 	updateSQL := fmt.Sprintf("UPDATE %s SET %s %s", modelType.tableName, setClauses.String(), fragment)
-	finalArgs := append(updateValues, whereArgs...)
 
-	res, err := d.db.ExecContext(ctx, updateSQL, finalArgs...)
+	res, err := d.exec(ctx, newStatement(OpUpdate, modelType, queryFragment, updateSQL, vars))
 	if err != nil {
 		return 0, fmt.Errorf("failed to execute update: %w", err)
 	}
@@ -438,27 +1188,48 @@ func (d *DB) Update(ctx context.Context, structType any, queryFragment string, a
 // Query calls the underlying sql.DB Query method, but uses named parameters
 // like other dbmap methods. Query returns sql.Rows, which the caller is
 // responsible for closing.
-func (d *DB) Query(ctx context.Context, sql string, args map[string]any) (*sql.Rows, error) {
-	sql, argSlice, err := d.replaceNames(sql, args)
+func (d *DB) Query(ctx context.Context, query string, args any) (*sql.Rows, error) {
+	d = d.contextDB(ctx)
+
+	rawSQL, vars, err := d.bindQuery(query, args)
 	if err != nil {
 		return nil, err
 	}
-	return d.db.QueryContext(ctx, sql, argSlice...)
+
+	var rows *sql.Rows
+	_, err = d.execute(ctx, newStatement(OpRaw, nil, query, rawSQL, vars), func(ctx context.Context, stmt *Statement) (Result, error) {
+		var err error
+		rows, err = d.db.QueryContext(ctx, stmt.SQL, stmt.Args...)
+		return Result{}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		return nil, errQueryIntercepted
+	}
+
+	return rows, nil
 }
 
 // Exec calls the underlying sql.DB Exec method, but uses named parameters like
 // other dbmap methods.
-func (d *DB) Exec(ctx context.Context, sql string, args map[string]any) (sql.Result, error) {
-	sql, argSlice, err := d.replaceNames(sql, args)
+func (d *DB) Exec(ctx context.Context, query string, args any) (sql.Result, error) {
+	d = d.contextDB(ctx)
+
+	rawSQL, vars, err := d.bindQuery(query, args)
 	if err != nil {
 		return nil, err
 	}
-	return d.db.ExecContext(ctx, sql, argSlice...)
+
+	return d.exec(ctx, newStatement(OpRaw, nil, query, rawSQL, vars))
 }
 
 // UpdateRecord updates a single record in the database based on the provided struct.
 // The dest parameter should be a pointer to a struct of the record to update.
 func (d *DB) UpdateRecord(ctx context.Context, model any, updates Updates) error {
+	d = d.contextDB(ctx)
+
 	modelType, err := d.newModelType(model)
 	if err != nil {
 		return fmt.Errorf("failed to update data: %w", err)
@@ -471,11 +1242,104 @@ func (d *DB) UpdateRecord(ctx context.Context, model any, updates Updates) error
 	}
 
 	value := concreteValue(model)
-	idField, ok := d.findIDField(value, modelType)
-	if !ok {
+	if len(modelType.primaryKey) == 0 {
 		return fmt.Errorf("struct does not have an ID field")
 	}
 
+	if !modelType.hooks.beforeUpdate {
+		if err := d.validateUpdates(ctx, modelType, value, updates); err != nil {
+			return err
+		}
+		return d.updateRecord(ctx, modelType, value, updates)
+	}
+
+	// The record is validated after BeforeUpdate, so the updates it adds are
+	// validated too.
+	return d.Transaction(ctx, func(tx *DB) error {
+		updates := maps.Clone(updates)
+		if err := tx.beforeUpdate(ctx, modelType, value, updates); err != nil {
+			return err
+		}
+		if len(updates) == 0 {
+			return ErrNoUpdates
+		}
+		if err := tx.validateUpdates(ctx, modelType, value, updates); err != nil {
+			return err
+		}
+
+		return tx.updateRecord(ctx, modelType, value, updates)
+	})
+}
+
+// validateUpdates validates value as it will look after applying updates.
+func (d *DB) validateUpdates(ctx context.Context, modelType *modelType, value reflect.Value, updates Updates) error {
+	if modelType.validations == nil && !modelType.implementsValidator {
+		return nil
+	}
+
+	updated, err := applyUpdates(modelType, value, updates)
+	if err != nil {
+		return err
+	}
+
+	return d.validate(ctx, modelType, updated)
+}
+
+// applyUpdates returns a copy of value with the updates applied. Values are
+// converted to the field's type when possible, e.g. an int for an int64 field,
+// like the driver does when writing them.
+func applyUpdates(modelType *modelType, value reflect.Value, updates Updates) (reflect.Value, error) {
+	updated := reflect.New(modelType.elemType).Elem()
+	updated.Set(value)
+
+	for fieldName, val := range updates {
+		field := updated.FieldByName(fieldName)
+		if !field.IsValid() || !field.CanSet() {
+			return reflect.Value{}, fmt.Errorf("cannot update missing or unexported field: %s", fieldName)
+		}
+
+		newValue, ok := convertUpdate(val, field.Type())
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("cannot assign %T to field %s of type %s", val, fieldName, field.Type())
+		}
+		field.Set(newValue)
+	}
+
+	return updated, nil
+}
+
+// convertUpdate returns val converted to typ. Nil values become the zero
+// value, and values of a pointer's element type are stored in a new pointer.
+func convertUpdate(val any, typ reflect.Type) (reflect.Value, bool) {
+	if val == nil {
+		return reflect.Zero(typ), true
+	}
+
+	newValue := reflect.ValueOf(val)
+	switch {
+	case newValue.Type().AssignableTo(typ):
+		return newValue, true
+	case (newValue.CanInt() || newValue.CanUint()) && typ.Kind() == reflect.String:
+		// Go converts integers to strings as runes, unlike the driver
+		return reflect.Value{}, false
+	case newValue.CanConvert(typ):
+		return newValue.Convert(typ), true
+	case typ.Kind() == reflect.Pointer:
+		elem, ok := convertUpdate(val, typ.Elem())
+		if !ok {
+			return reflect.Value{}, false
+		}
+		ptr := reflect.New(typ.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, true
+	default:
+		return reflect.Value{}, false
+	}
+}
+
+// updateRecord updates the columns of the updates, and the updated_at column,
+// of the row of value by primary key.
+func (d *DB) updateRecord(ctx context.Context, modelType *modelType, value reflect.Value, updates Updates) error {
 	now := d.time.Now().UTC()
 	if modelType.updatedAtFieldIndex >= 0 {
 		updates = maps.Clone(updates)
@@ -493,78 +1357,42 @@ func (d *DB) UpdateRecord(ctx context.Context, model any, updates Updates) error
 		}
 	}
 
+	// Build the updated record first, so values that can't be stored in their
+	// fields are rejected before the update is executed.
+	updated, err := applyUpdates(modelType, value, updates)
+	if err != nil {
+		return err
+	}
+
 	var setClauses strings.Builder
-	updateValues := make([]any, 0, len(updates))
+	vars := d.newBindVars(len(updates) + 1)
 
 	for fieldName, val := range updates {
 		field, ok := modelType.elemType.FieldByName(fieldName)
 		if !ok || !field.IsExported() {
 			return fmt.Errorf("cannot update missing or unexported field: %s", fieldName)
 		}
-		col := field.Tag.Get("db")
-		if col == "" {
-			col = snake_case(field.Name)
-		}
+		col := columnName(field)
 		if setClauses.Len() > 0 {
 			setClauses.WriteString(", ")
 		}
-		setClauses.WriteString(fmt.Sprintf("`%s` = ?", col))
-		updateValues = append(updateValues, val)
+		setClauses.WriteString(fmt.Sprintf("%s = %s", d.dialect().Quote(col), vars.add(col, val)))
 	}
 
-	updateSQL := fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", modelType.tableName, setClauses.String())
-	updateValues = append(updateValues, idField.Interface())
-	_, err = d.db.ExecContext(ctx, updateSQL, updateValues...)
+	updateSQL := fmt.Sprintf("UPDATE %s SET %s WHERE %s", modelType.tableName, setClauses.String(), d.primaryKeyCondition(modelType, vars, value))
+	_, err = d.exec(ctx, newStatement(OpUpdate, modelType, "", updateSQL, vars))
 	if err != nil {
 		return fmt.Errorf("failed to execute update: %w", err)
 	}
 
-	for fieldName, val := range updates {
-		field := value.FieldByName(fieldName)
-		if field.IsValid() && field.CanSet() {
-			field.Set(reflect.ValueOf(val))
-		}
-	}
+	value.Set(updated)
 
 	return nil
 }
 
-// Transaction executes the provided function within a database transaction. If
-// the function returns an error, the transaction is rolled back, otherwise it
-// is committed.
-//
-// Transactions can not be nested at this time.
-func (d *DB) Transaction(ctx context.Context, fn func(tx *DB) error) error {
-	if _, ok := d.db.(*sql.DB); !ok {
-		return fmt.Errorf("nested transactions are not supported")
-	}
-	tx, err := d.db.(*sql.DB).BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer func() {
-		if p := recover(); p != nil {
-			_ = tx.Rollback()
-			panic(p)
-		} else if err != nil {
-			_ = tx.Rollback()
-		} else {
-			err = tx.Commit()
-		}
-	}()
-
-	txDB := &DB{
-		db:             tx,
-		modelTypeCache: d.modelTypeCache,
-		Pluralizer:     d.Pluralizer,
-		time:           d.time,
-	}
+func (d *DB) Exists(ctx context.Context, structType any, queryFragment string, args any) (bool, error) {
+	d = d.contextDB(ctx)
 
-	err = fn(txDB)
-	return err
-}
-
-func (d *DB) Exists(ctx context.Context, structType any, queryFragment string, args Args) (bool, error) {
 	modelType, err := newModelType(structType, d.Pluralizer)
 	if err != nil {
 		return false, err
@@ -574,29 +1402,21 @@ func (d *DB) Exists(ctx context.Context, structType any, queryFragment string, a
 		return false, fmt.Errorf("destination must be a struct or pointer to a struct, got %s", modelType.baseType.Kind())
 	}
 
-	rows, err := d.Query(
-		ctx,
-		fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s "+queryFragment+")", modelType.tableName),
-		args,
-	)
-
+	fragment, vars, err := d.bindQuery(queryFragment, args)
 	if err != nil {
 		return false, err
 	}
 
 	var found bool
-	if rows.Next() {
-		err := rows.Scan(&found)
-
-		if err != nil {
-			return false, nil
-		}
-	}
+	query := fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s %s)", modelType.tableName, fragment)
+	err = d.queryValue(ctx, newStatement(OpSelect, modelType, queryFragment, query, vars), &found)
 
-	return found, nil
+	return found, err
 }
 
-func (d *DB) Count(ctx context.Context, structType any, queryFragment string, args Args) (int64, error) {
+func (d *DB) Count(ctx context.Context, structType any, queryFragment string, args any) (int64, error) {
+	d = d.contextDB(ctx)
+
 	modelType, err := newModelType(structType, d.Pluralizer)
 	if err != nil {
 		return 0, err
@@ -606,27 +1426,39 @@ func (d *DB) Count(ctx context.Context, structType any, queryFragment string, ar
 		return 0, fmt.Errorf("destination must be a struct or pointer to a struct, got %s", modelType.baseType.Kind())
 	}
 
-	rows, err := d.Query(
-		ctx,
-		fmt.Sprintf("SELECT COUNT(*) FROM %s "+queryFragment, modelType.tableName),
-		args,
-	)
-
+	fragment, vars, err := d.bindQuery(queryFragment, args)
 	if err != nil {
 		return 0, err
 	}
 
 	var count int64
-	if rows.Next() {
-		err := rows.Scan(&count)
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s %s", modelType.tableName, fragment)
+	err = d.queryValue(ctx, newStatement(OpSelect, modelType, queryFragment, query, vars), &count)
+
+	return count, err
+}
 
+// queryValue scans the single value returned by stmt into dest, leaving dest
+// untouched when no row is returned.
+func (d *DB) queryValue(ctx context.Context, stmt *Statement, dest any) error {
+	_, err := d.execute(ctx, stmt, func(ctx context.Context, stmt *Statement) (Result, error) {
+		rows, err := d.db.QueryContext(ctx, stmt.SQL, stmt.Args...)
 		if err != nil {
-			return 0, nil
+			return Result{}, err
 		}
-	}
+		defer rows.Close()
 
-	return count, nil
+		if !rows.Next() {
+			return Result{}, rows.Err()
+		}
+		if err := rows.Scan(dest); err != nil {
+			return Result{}, err
+		}
 
+		return Result{RowsReturned: 1}, rows.Err()
+	})
+
+	return err
 }
 
 func concreteValue(dest any) reflect.Value {
@@ -653,8 +1485,60 @@ func scanStruct(fields []string, rows *sql.Rows, dest reflect.Value) error {
 	return nil
 }
 
-func (d *DB) replaceNames(rawSql string, args Args) (string, []any, error) {
-	finalArgs := make([]any, 0, len(args))
+// bindVars collects the positional arguments of a statement and renders the
+// dialect specific placeholder for each of them.
+type bindVars struct {
+	dialect Dialect
+	args    []any
+	// named are the names of args, see Statement.NamedArgs
+	named []NamedArg
+	// sensitive are the named parameters bound from sensitive columns of
+	// struct parameters
+	sensitive map[string]bool
+}
+
+func (d *DB) newBindVars(capacity int) *bindVars {
+	return &bindVars{dialect: d.dialect(), args: make([]any, 0, capacity)}
+}
+
+// add appends value to the statement arguments and returns its placeholder.
+// name is the named parameter or column the value is bound from.
+func (b *bindVars) add(name string, value any) string {
+	b.args = append(b.args, value)
+	b.named = append(b.named, NamedArg{Name: name, Value: value, Sensitive: b.sensitive[name]})
+	return b.dialect.Placeholder(len(b.args))
+}
+
+func (d *DB) replaceNames(rawSql string, args any) (string, []any, error) {
+	sql, vars, err := d.bindQuery(rawSql, args)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return sql, vars.args, nil
+}
+
+// bindQuery is like replaceNames, but returns the bindVars so statements can
+// describe their arguments.
+func (d *DB) bindQuery(rawSql string, args any) (string, *bindVars, error) {
+	vars := d.newBindVars(0)
+	sql, err := d.bindNames(vars, rawSql, args)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return sql, vars, nil
+}
+
+// bindNames replaces the named parameters in rawSql with placeholders, adding
+// their values to vars. Placeholders are numbered after any arguments already
+// present in vars so fragments can be appended to generated statements.
+func (d *DB) bindNames(vars *bindVars, rawSql string, rawArgs any) (string, error) {
+	args, err := d.namedArgs(vars, rawArgs)
+	if err != nil {
+		return "", err
+	}
+
 	builder := strings.Builder{}
 
 	sql := []rune(rawSql)
@@ -687,10 +1571,13 @@ func (d *DB) replaceNames(rawSql string, args Args) (string, []any, error) {
 				// catch the outer loop up to the end of the name
 				i += name.Len()
 				if _, ok := args[name.String()]; !ok {
-					return "", nil, fmt.Errorf("missing argument for named parameter: %s", name.String())
+					return "", fmt.Errorf("missing argument for named parameter: %s", name.String())
 				}
-				finalArgs = append(finalArgs, args[name.String()])
-				builder.WriteRune('?')
+				placeholders, err := d.bindArg(vars, name.String(), args[name.String()])
+				if err != nil {
+					return "", err
+				}
+				builder.WriteString(placeholders)
 			} else {
 				builder.WriteRune('$')
 			}
@@ -699,7 +1586,79 @@ func (d *DB) replaceNames(rawSql string, args Args) (string, []any, error) {
 		}
 	}
 
-	return builder.String(), finalArgs, nil
+	return builder.String(), nil
+}
+
+// namedArgs returns the named parameters for args, which can be Args or a
+// struct (or pointer to a struct). Struct fields are available by both their
+// field name and column name.
+func (d *DB) namedArgs(vars *bindVars, args any) (Args, error) {
+	switch args := args.(type) {
+	case nil:
+		return Args{}, nil
+	case Args:
+		return args, nil
+	}
+
+	modelType, err := d.newModelType(args)
+	if err != nil || !modelType.isStruct && !modelType.isStructPointer {
+		return nil, fmt.Errorf("named parameters must be dbmap.Args or a struct, got %T", args)
+	}
+
+	value := reflect.ValueOf(args)
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil, fmt.Errorf("named parameters must not be a nil pointer")
+		}
+		value = value.Elem()
+	}
+
+	named := make(Args, len(modelType.columns)*2)
+	for _, col := range modelType.columns {
+		fieldValue := value.FieldByName(col.Name).Interface()
+		named[col.Name] = fieldValue
+		named[col.name] = fieldValue
+	}
+
+	if len(modelType.sensitive) > 0 {
+		if vars.sensitive == nil {
+			vars.sensitive = make(map[string]bool, len(modelType.sensitive))
+		}
+		maps.Copy(vars.sensitive, modelType.sensitive)
+	}
+
+	return named, nil
+}
+
+// bindArg adds value to vars and returns its placeholder. Slices and arrays,
+// other than []byte and driver.Valuer implementations, are expanded into a
+// comma separated list of placeholders so they can be used in `IN` clauses.
+func (d *DB) bindArg(vars *bindVars, name string, value any) (string, error) {
+	if _, ok := value.(driver.Valuer); ok {
+		return vars.add(name, value), nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array || v.Type().Elem().Kind() == reflect.Uint8 {
+		return vars.add(name, value), nil
+	}
+
+	if v.Len() == 0 {
+		if d.AllowEmptySlices {
+			return "NULL", nil
+		}
+		return "", fmt.Errorf("%w: %s", ErrEmptySlice, name)
+	}
+
+	var placeholders strings.Builder
+	for i := range v.Len() {
+		if i > 0 {
+			placeholders.WriteString(", ")
+		}
+		placeholders.WriteString(vars.add(name, v.Index(i).Interface()))
+	}
+
+	return placeholders.String(), nil
 }
 
 // generateSelect creates a SELECT SQL statement based on the struct type, mapping struct fields to database columns.
@@ -709,21 +1668,128 @@ func (d *DB) generateSelect(model *modelType) (string, []string) {
 	var columnStr strings.Builder
 
 	for _, col := range model.columns {
-		columnName := col.Tag.Get("db")
-		if columnName == "" {
-			columnName = snake_case(col.Name)
-		}
 		columns = append(columns, col.Name)
 		if len(columns) > 1 {
 			columnStr.WriteString(", ")
 		}
-		columnStr.WriteString("`" + model.tableName + "`.")
-		columnStr.WriteString("`" + columnName + "`")
+		columnStr.WriteString(d.dialect().Quote(model.tableName) + ".")
+		columnStr.WriteString(d.dialect().Quote(col.name))
 	}
 
 	return fmt.Sprintf("SELECT %s FROM %s", columnStr.String(), model.tableName), columns
 }
 
+// generateInsert creates an INSERT SQL statement for the struct values,
+// returning the SQL string, the arguments to bind, and the struct fields returned
+// by the statement. All values must insert the same columns, see
+// insertColumns.
+//
+// When the dialect uses the Returning strategy, the ID column and columns
+// tagged with the `default` option are returned by the statement so they can
+// be scanned back into the structs.
+func (d *DB) generateInsert(model *modelType, values ...reflect.Value) (string, *bindVars, []string) {
+	return d.buildInsert(model, values, "", d.returningColumns(model))
+}
+
+// buildInsert creates an INSERT SQL statement for the struct values, appending
+// clause, e.g. an upsert clause, and returning the given columns.
+func (d *DB) buildInsert(model *modelType, values []reflect.Value, clause string, returning []column) (string, *bindVars, []string) {
+	dialect := d.dialect()
+	columns := insertColumns(model, values[0])
+	vars := d.newBindVars(len(columns) * len(values))
+	var insertColumnNames strings.Builder
+	var insertValuePlaceholders strings.Builder
+	var returningColumns strings.Builder
+	var returningFields []string
+
+	for i, col := range columns {
+		if i > 0 {
+			insertColumnNames.WriteString(", ")
+		}
+		insertColumnNames.WriteString(dialect.Quote(col.name))
+	}
+
+	for i, value := range values {
+		if i > 0 {
+			insertValuePlaceholders.WriteString(", ")
+		}
+		insertValuePlaceholders.WriteString("(")
+		for j, col := range columns {
+			if j > 0 {
+				insertValuePlaceholders.WriteString(", ")
+			}
+			insertValuePlaceholders.WriteString(vars.add(col.name, value.FieldByName(col.Name).Interface()))
+		}
+		insertValuePlaceholders.WriteString(")")
+	}
+
+	for i, col := range returning {
+		if i > 0 {
+			returningColumns.WriteString(", ")
+		}
+		returningColumns.WriteString(dialect.Quote(col.name))
+		returningFields = append(returningFields, col.Name)
+	}
+
+	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", model.tableName, insertColumnNames.String(), insertValuePlaceholders.String())
+	if clause != "" {
+		insertSQL += " " + clause
+	}
+	if returningColumns.Len() > 0 {
+		insertSQL += " RETURNING " + returningColumns.String()
+	}
+
+	return insertSQL, vars, returningFields
+}
+
+// returningColumns returns the columns an INSERT statement returns when the
+// dialect uses the Returning strategy.
+func (d *DB) returningColumns(model *modelType) []column {
+	if d.dialect().IDStrategy() != Returning {
+		return nil
+	}
+
+	var columns []column
+	for _, col := range model.columns {
+		if model.isGenerated(col) {
+			columns = append(columns, col)
+		}
+	}
+
+	return columns
+}
+
+// insertColumns returns the columns to insert for value. A zero valued ID
+// column, or column tagged with the `default` option, is omitted so the
+// database can generate it.
+func insertColumns(model *modelType, value reflect.Value) []column {
+	columns := make([]column, 0, len(model.columns))
+	for _, col := range model.columns {
+		if model.isGenerated(col) && value.FieldByName(col.Name).IsZero() {
+			continue
+		}
+		columns = append(columns, col)
+	}
+
+	return columns
+}
+
+// setID sets an integer ID field to id, ignoring non-integer fields.
+func setID(idField reflect.Value, id int64) {
+	if !idField.IsValid() || !idField.CanSet() {
+		return
+	}
+
+	switch idField.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		idField.SetInt(id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if id >= 0 {
+			idField.SetUint(uint64(id))
+		}
+	}
+}
+
 func snake_case(name string) string {
 	snaked := strings.Builder{}
 
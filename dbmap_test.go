@@ -1,7 +1,11 @@
 package dbmap
 
 import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -200,6 +204,34 @@ func TestDB_replaceNames(t *testing.T) {
 			expectedSql:  "WHERE id = ?, name = ?;",
 			expectedArgs: []any{1, "test"},
 		},
+		{
+			name:         "slice parameter expands into placeholders",
+			rawSql:       "SELECT * FROM users WHERE id IN ($ids) AND name = $name",
+			args:         map[string]any{"ids": []int{1, 2, 3}, "name": "John"},
+			expectedSql:  "SELECT * FROM users WHERE id IN (?, ?, ?) AND name = ?",
+			expectedArgs: []any{1, 2, 3, "John"},
+		},
+		{
+			name:         "array parameter expands into placeholders",
+			rawSql:       "SELECT * FROM users WHERE name IN ($names)",
+			args:         map[string]any{"names": [2]string{"Fox", "Dana"}},
+			expectedSql:  "SELECT * FROM users WHERE name IN (?, ?)",
+			expectedArgs: []any{"Fox", "Dana"},
+		},
+		{
+			name:         "byte slice parameter is not expanded",
+			rawSql:       "SELECT * FROM files WHERE checksum = $checksum",
+			args:         map[string]any{"checksum": []byte("abc")},
+			expectedSql:  "SELECT * FROM files WHERE checksum = ?",
+			expectedArgs: []any{[]byte("abc")},
+		},
+		{
+			name:        "empty slice parameter should return error",
+			rawSql:      "SELECT * FROM users WHERE id IN ($ids)",
+			args:        map[string]any{"ids": []int{}},
+			shouldError: true,
+			errorMsg:    "empty slice provided for named parameter: ids",
+		},
 		{
 			name:         "unicode characters in SQL",
 			rawSql:       "SELECT * FROM üsers WHERE nämé = $name",
@@ -247,3 +279,505 @@ func TestDB_generateSelect(t *testing.T) {
 	require.Equal(t, expectedSQL, actualSQL)
 	require.Equal(t, expectedFields, actualFields)
 }
+
+func TestDB_replaceNames_numberedPlaceholders(t *testing.T) {
+	db := &DB{Dialect: PostgreSQL}
+
+	actualSql, actualArgs, err := db.replaceNames(
+		"SELECT * FROM logs WHERE user_id = $user_id OR admin_id = $user_id AND price LIKE '$$19.99' AND level = $level",
+		map[string]any{"user_id": 456, "level": "warn"},
+	)
+
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM logs WHERE user_id = $1 OR admin_id = $2 AND price LIKE '$19.99' AND level = $3", actualSql)
+	require.Equal(t, []any{456, 456, "warn"}, actualArgs)
+}
+
+func TestDB_replaceNames_slices(t *testing.T) {
+	t.Run("numbers expanded placeholders", func(t *testing.T) {
+		db := &DB{Dialect: PostgreSQL}
+
+		actualSql, actualArgs, err := db.replaceNames("WHERE id IN ($ids) AND name = $name", map[string]any{"ids": []int64{4, 5}, "name": "Fox"})
+
+		require.NoError(t, err)
+		require.Equal(t, "WHERE id IN ($1, $2) AND name = $3", actualSql)
+		require.Equal(t, []any{int64(4), int64(5), "Fox"}, actualArgs)
+	})
+
+	t.Run("empty slices return ErrEmptySlice", func(t *testing.T) {
+		db := &DB{}
+
+		_, _, err := db.replaceNames("WHERE id IN ($ids)", map[string]any{"ids": []string(nil)})
+
+		require.ErrorIs(t, err, ErrEmptySlice)
+	})
+
+	t.Run("empty slices render NULL when allowed", func(t *testing.T) {
+		db := &DB{AllowEmptySlices: true}
+
+		actualSql, actualArgs, err := db.replaceNames("WHERE id IN ($ids)", map[string]any{"ids": []int{}})
+
+		require.NoError(t, err)
+		require.Equal(t, "WHERE id IN (NULL)", actualSql)
+		require.Equal(t, []any{}, actualArgs)
+	})
+
+	t.Run("driver.Valuer slices are not expanded", func(t *testing.T) {
+		db := &DB{}
+
+		actualSql, actualArgs, err := db.replaceNames("WHERE tags = $tags", map[string]any{"tags": valuerSlice{"a", "b"}})
+
+		require.NoError(t, err)
+		require.Equal(t, "WHERE tags = ?", actualSql)
+		require.Equal(t, []any{valuerSlice{"a", "b"}}, actualArgs)
+	})
+}
+
+func TestDB_replaceNames_struct(t *testing.T) {
+	type TestStruct struct {
+		ID    int    `db:"id"`
+		Email string `db:"email_address"`
+		Age   int
+	}
+
+	db := New(nil)
+
+	t.Run("resolves field and column names", func(t *testing.T) {
+		actualSql, actualArgs, err := db.replaceNames(
+			"WHERE id = $id AND email_address = $Email AND age > $age",
+			TestStruct{ID: 1, Email: "mulder@fbi.gov", Age: 32},
+		)
+
+		require.NoError(t, err)
+		require.Equal(t, "WHERE id = ? AND email_address = ? AND age > ?", actualSql)
+		require.Equal(t, []any{1, "mulder@fbi.gov", 32}, actualArgs)
+	})
+
+	t.Run("accepts pointers to structs", func(t *testing.T) {
+		actualSql, actualArgs, err := db.replaceNames("WHERE id = $ID", &TestStruct{ID: 2})
+
+		require.NoError(t, err)
+		require.Equal(t, "WHERE id = ?", actualSql)
+		require.Equal(t, []any{2}, actualArgs)
+	})
+
+	t.Run("missing fields return an error", func(t *testing.T) {
+		_, _, err := db.replaceNames("WHERE name = $name", TestStruct{})
+
+		require.EqualError(t, err, "missing argument for named parameter: name")
+	})
+
+	t.Run("nil args have no parameters", func(t *testing.T) {
+		actualSql, actualArgs, err := db.replaceNames("WHERE active = 1", nil)
+
+		require.NoError(t, err)
+		require.Equal(t, "WHERE active = 1", actualSql)
+		require.Equal(t, []any{}, actualArgs)
+	})
+
+	t.Run("unsupported types return an error", func(t *testing.T) {
+		_, _, err := db.replaceNames("WHERE id = $id", 5)
+		require.EqualError(t, err, "named parameters must be dbmap.Args or a struct, got int")
+
+		_, _, err = db.replaceNames("WHERE id = $id", (*TestStruct)(nil))
+		require.EqualError(t, err, "named parameters must not be a nil pointer")
+	})
+}
+
+type valuerSlice []string
+
+func (v valuerSlice) Value() (driver.Value, error) {
+	return strings.Join(v, ","), nil
+}
+
+func TestDB_bindNames_continuesNumbering(t *testing.T) {
+	db := &DB{Dialect: PostgreSQL}
+
+	vars := db.newBindVars(2)
+	require.Equal(t, "$1", vars.add("updated_at", "updated"))
+
+	actualSql, err := db.bindNames(vars, "WHERE id = $id", map[string]any{"id": 1})
+
+	require.NoError(t, err)
+	require.Equal(t, "WHERE id = $2", actualSql)
+	require.Equal(t, []any{"updated", 1}, vars.args)
+}
+
+func TestDB_generateSelect_dialects(t *testing.T) {
+	type TestStruct struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+
+	model, err := newModelType(TestStruct{}, defaultPluralizer)
+	require.NoError(t, err)
+
+	db := &DB{Dialect: PostgreSQL}
+	actualSQL, _ := db.generateSelect(model)
+	require.Equal(t, `SELECT "test_structs"."id", "test_structs"."name" FROM test_structs`, actualSQL)
+
+	db = &DB{Dialect: SQLite}
+	actualSQL, _ = db.generateSelect(model)
+	require.Equal(t, `SELECT "test_structs"."id", "test_structs"."name" FROM test_structs`, actualSQL)
+}
+
+func TestDB_generateInsert(t *testing.T) {
+	type TestStruct struct {
+		ID    int    `db:"id"`
+		Name  string `db:"name"`
+		Email string `db:"email_address"`
+	}
+
+	model, err := newModelType(&TestStruct{}, defaultPluralizer)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		dialect        Dialect
+		value          TestStruct
+		expectedSQL    string
+		expectedArgs   []any
+		expectedFields []string
+	}{
+		{
+			name:         "mysql omits zero ID",
+			dialect:      MySQL,
+			value:        TestStruct{Name: "Fox", Email: "mulder@fbi.gov"},
+			expectedSQL:  "INSERT INTO test_structs (`name`, `email_address`) VALUES (?, ?)",
+			expectedArgs: []any{"Fox", "mulder@fbi.gov"},
+		},
+		{
+			name:         "mysql includes provided ID",
+			dialect:      MySQL,
+			value:        TestStruct{ID: 7, Name: "Fox", Email: "mulder@fbi.gov"},
+			expectedSQL:  "INSERT INTO test_structs (`id`, `name`, `email_address`) VALUES (?, ?, ?)",
+			expectedArgs: []any{7, "Fox", "mulder@fbi.gov"},
+		},
+		{
+			name:           "sqlite returns ID",
+			dialect:        SQLite,
+			value:          TestStruct{Name: "Fox", Email: "mulder@fbi.gov"},
+			expectedSQL:    `INSERT INTO test_structs ("name", "email_address") VALUES (?, ?) RETURNING "id"`,
+			expectedArgs:   []any{"Fox", "mulder@fbi.gov"},
+			expectedFields: []string{"ID"},
+		},
+		{
+			name:           "postgresql returns ID",
+			dialect:        PostgreSQL,
+			value:          TestStruct{Name: "Fox", Email: "mulder@fbi.gov"},
+			expectedSQL:    `INSERT INTO test_structs ("name", "email_address") VALUES ($1, $2) RETURNING "id"`,
+			expectedArgs:   []any{"Fox", "mulder@fbi.gov"},
+			expectedFields: []string{"ID"},
+		},
+		{
+			name:           "mariadb returns ID",
+			dialect:        MariaDB,
+			value:          TestStruct{Name: "Fox", Email: "mulder@fbi.gov"},
+			expectedSQL:    "INSERT INTO test_structs (`name`, `email_address`) VALUES (?, ?) RETURNING `id`",
+			expectedArgs:   []any{"Fox", "mulder@fbi.gov"},
+			expectedFields: []string{"ID"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{Dialect: tt.dialect}
+
+			actualSQL, actualVars, actualFields := db.generateInsert(model, reflect.ValueOf(tt.value))
+
+			require.Equal(t, tt.expectedSQL, actualSQL)
+			require.Equal(t, tt.expectedArgs, actualVars.args)
+			require.Equal(t, tt.expectedFields, actualFields)
+		})
+	}
+}
+
+func TestDB_generateInsert_defaults(t *testing.T) {
+	type Token struct {
+		UUID      string    `db:"uuid,default"`
+		Name      string    `db:"name"`
+		CreatedAt time.Time `db:"created_at,default"`
+	}
+
+	model, err := newModelType(&Token{}, defaultPluralizer)
+	require.NoError(t, err)
+
+	t.Run("returns defaulted columns", func(t *testing.T) {
+		db := &DB{Dialect: PostgreSQL}
+
+		actualSQL, actualVars, actualFields := db.generateInsert(model, reflect.ValueOf(Token{Name: "api"}))
+
+		require.Equal(t, `INSERT INTO tokens ("name") VALUES ($1) RETURNING "uuid", "created_at"`, actualSQL)
+		require.Equal(t, []any{"api"}, actualVars.args)
+		require.Equal(t, []string{"UUID", "CreatedAt"}, actualFields)
+	})
+
+	t.Run("inserts provided values for defaulted columns", func(t *testing.T) {
+		db := &DB{Dialect: PostgreSQL}
+
+		actualSQL, actualVars, actualFields := db.generateInsert(model, reflect.ValueOf(Token{UUID: "abc", Name: "api"}))
+
+		require.Equal(t, `INSERT INTO tokens ("uuid", "name") VALUES ($1, $2) RETURNING "uuid", "created_at"`, actualSQL)
+		require.Equal(t, []any{"abc", "api"}, actualVars.args)
+		require.Equal(t, []string{"UUID", "CreatedAt"}, actualFields)
+	})
+
+	t.Run("omits defaulted columns without returning them", func(t *testing.T) {
+		db := &DB{Dialect: MySQL}
+
+		actualSQL, actualVars, actualFields := db.generateInsert(model, reflect.ValueOf(Token{Name: "api"}))
+
+		require.Equal(t, "INSERT INTO tokens (`name`) VALUES (?)", actualSQL)
+		require.Equal(t, []any{"api"}, actualVars.args)
+		require.Empty(t, actualFields)
+	})
+}
+
+func TestDB_generateInsert_multipleRows(t *testing.T) {
+	type TestStruct struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+
+	model, err := newModelType(&[]TestStruct{}, defaultPluralizer)
+	require.NoError(t, err)
+
+	values := []reflect.Value{
+		reflect.ValueOf(TestStruct{Name: "Fox"}),
+		reflect.ValueOf(TestStruct{Name: "Dana"}),
+	}
+
+	db := &DB{}
+	actualSQL, actualVars, _ := db.generateInsert(model, values...)
+	require.Equal(t, "INSERT INTO test_structs (`name`) VALUES (?), (?)", actualSQL)
+	require.Equal(t, []any{"Fox", "Dana"}, actualVars.args)
+
+	db = &DB{Dialect: PostgreSQL}
+	actualSQL, actualVars, actualFields := db.generateInsert(model, values...)
+	require.Equal(t, `INSERT INTO test_structs ("name") VALUES ($1), ($2) RETURNING "id"`, actualSQL)
+	require.Equal(t, []any{"Fox", "Dana"}, actualVars.args)
+	require.Equal(t, []string{"ID"}, actualFields)
+}
+
+type smallDialect struct{ mysqlDialect }
+
+func (smallDialect) MaxPlaceholders() int { return 5 }
+
+func TestDB_insertBatches(t *testing.T) {
+	type TestStruct struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+		Age  int    `db:"age"`
+	}
+
+	model, err := newModelType(&[]TestStruct{}, defaultPluralizer)
+	require.NoError(t, err)
+
+	values := []reflect.Value{
+		reflect.ValueOf(TestStruct{Name: "Fox"}),
+		reflect.ValueOf(TestStruct{Name: "Dana"}),
+		reflect.ValueOf(TestStruct{ID: 3, Name: "Walter"}),
+		reflect.ValueOf(TestStruct{Name: "John"}),
+		reflect.ValueOf(TestStruct{Name: "Monica"}),
+		reflect.ValueOf(TestStruct{Name: "Alex"}),
+	}
+
+	db := &DB{Dialect: smallDialect{}}
+	batches := db.insertBatches(model, values)
+
+	batchNames := make([][]string, 0, len(batches))
+	for _, batch := range batches {
+		names := make([]string, 0, len(batch))
+		for _, value := range batch {
+			names = append(names, value.FieldByName("Name").String())
+		}
+		batchNames = append(batchNames, names)
+	}
+
+	require.Equal(t, [][]string{
+		{"Fox", "Dana"},
+		{"Walter"},
+		{"John", "Monica"},
+		{"Alex"},
+	}, batchNames)
+
+	db = &DB{Dialect: SQLite}
+	require.Len(t, db.insertBatches(model, values), len(values), "rows returned in arbitrary order can't be batched")
+
+	db = &DB{Dialect: PostgreSQL}
+	require.Len(t, db.insertBatches(model, values), 3)
+}
+
+func TestDB_primaryKeyCondition(t *testing.T) {
+	type TestStruct struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+
+	type Membership struct {
+		TeamID int    `db:"team_id,pk"`
+		UserID int    `db:"user_id,pk"`
+		Role   string `db:"role"`
+	}
+
+	model, err := newModelType(&TestStruct{}, defaultPluralizer)
+	require.NoError(t, err)
+	compositeModel, err := newModelType(&Membership{}, defaultPluralizer)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		dialect      Dialect
+		model        *modelType
+		values       []reflect.Value
+		expectedSQL  string
+		expectedArgs []any
+	}{
+		{
+			name:         "single record",
+			dialect:      MySQL,
+			model:        model,
+			values:       []reflect.Value{reflect.ValueOf(TestStruct{ID: 1})},
+			expectedSQL:  "`id` = ?",
+			expectedArgs: []any{1},
+		},
+		{
+			name:         "multiple records",
+			dialect:      MySQL,
+			model:        model,
+			values:       []reflect.Value{reflect.ValueOf(TestStruct{ID: 1}), reflect.ValueOf(TestStruct{ID: 2})},
+			expectedSQL:  "`id` IN (?, ?)",
+			expectedArgs: []any{1, 2},
+		},
+		{
+			name:         "single record with composite primary key",
+			dialect:      PostgreSQL,
+			model:        compositeModel,
+			values:       []reflect.Value{reflect.ValueOf(Membership{TeamID: 1, UserID: 2})},
+			expectedSQL:  `"team_id" = $1 AND "user_id" = $2`,
+			expectedArgs: []any{1, 2},
+		},
+		{
+			name:         "multiple records with composite primary key",
+			dialect:      PostgreSQL,
+			model:        compositeModel,
+			values:       []reflect.Value{reflect.ValueOf(Membership{TeamID: 1, UserID: 2}), reflect.ValueOf(Membership{TeamID: 1, UserID: 3})},
+			expectedSQL:  `("team_id", "user_id") IN (($1, $2), ($3, $4))`,
+			expectedArgs: []any{1, 2, 1, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{Dialect: tt.dialect}
+			vars := db.newBindVars(0)
+
+			actualSQL := db.primaryKeyCondition(tt.model, vars, tt.values...)
+
+			require.Equal(t, tt.expectedSQL, actualSQL)
+			require.Equal(t, tt.expectedArgs, vars.args)
+		})
+	}
+}
+
+func TestDB_FromConn_sharesConfiguration(t *testing.T) {
+	db := New(nil)
+	db.Dialect = PostgreSQL
+	db.AllowEmptySlices = true
+
+	connDB := db.FromConn(nil)
+	require.Same(t, db.modelTypeCache, connDB.modelTypeCache)
+	require.Equal(t, db.Pluralizer, connDB.Pluralizer)
+	require.Equal(t, db.time, connDB.time)
+	require.Equal(t, PostgreSQL, connDB.Dialect)
+	require.True(t, connDB.AllowEmptySlices)
+	require.Nil(t, connDB.tx)
+
+	txDB := db.FromTx(nil)
+	require.Same(t, db.modelTypeCache, txDB.modelTypeCache)
+	require.Equal(t, PostgreSQL, txDB.Dialect)
+	require.NotNil(t, txDB.tx)
+	require.True(t, txDB.tx.external)
+}
+
+func TestApplyUpdates(t *testing.T) {
+	type record struct {
+		ID       int64
+		Name     string
+		Nickname *string
+		Score    float64
+	}
+
+	modelType, err := newModelType(&record{}, defaultPluralizer)
+	require.NoError(t, err)
+
+	original := record{ID: 1, Name: "Fox", Score: 1.5}
+
+	t.Run("converts values to the field types", func(t *testing.T) {
+		updated, err := applyUpdates(modelType, reflect.ValueOf(original), Updates{"ID": 5, "Nickname": "Spooky", "Score": 2})
+		require.NoError(t, err)
+
+		nickname := "Spooky"
+		require.Equal(t, record{ID: 5, Name: "Fox", Nickname: &nickname, Score: 2}, updated.Interface())
+	})
+
+	t.Run("sets nil values to the zero value", func(t *testing.T) {
+		updated, err := applyUpdates(modelType, reflect.ValueOf(original), Updates{"Name": nil})
+		require.NoError(t, err)
+		require.Equal(t, record{ID: 1, Score: 1.5}, updated.Interface())
+	})
+
+	t.Run("rejects values that can't be stored in the field", func(t *testing.T) {
+		_, err := applyUpdates(modelType, reflect.ValueOf(original), Updates{"Name": 65})
+		require.EqualError(t, err, "cannot assign int to field Name of type string")
+
+		_, err = applyUpdates(modelType, reflect.ValueOf(original), Updates{"Score": "high"})
+		require.EqualError(t, err, "cannot assign string to field Score of type float64")
+	})
+
+	t.Run("rejects missing fields", func(t *testing.T) {
+		_, err := applyUpdates(modelType, reflect.ValueOf(original), Updates{"Missing": 1})
+		require.EqualError(t, err, "cannot update missing or unexported field: Missing")
+	})
+}
+
+func TestDB_upsertReturningColumns(t *testing.T) {
+	type Membership struct {
+		TeamID    int       `db:"team_id,pk"`
+		UserID    int       `db:"user_id,pk"`
+		CreatedAt time.Time `db:"created_at"`
+	}
+	type Post struct {
+		ID        int       `db:"id"`
+		CreatedAt time.Time `db:"created_at"`
+	}
+
+	membership, err := newModelType(&Membership{}, defaultPluralizer)
+	require.NoError(t, err)
+	post, err := newModelType(&Post{}, defaultPluralizer)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		dialect  Dialect
+		model    *modelType
+		expected []string
+	}{
+		{name: "mysql", dialect: MySQL, model: post, expected: nil},
+		{name: "sqlite", dialect: SQLite, model: post, expected: []string{"id", "created_at"}},
+		{name: "sqlite without generated columns", dialect: SQLite, model: membership, expected: []string{"created_at"}},
+		{name: "postgresql without generated columns", dialect: PostgreSQL, model: membership, expected: []string{"created_at"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{Dialect: tt.dialect}
+
+			var names []string
+			for _, col := range db.upsertReturningColumns(tt.model) {
+				names = append(names, col.name)
+			}
+			require.Equal(t, tt.expected, names)
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package dbmap
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type (
+	// Dialect describes the SQL differences between database systems that
+	// dbmap needs to know about when generating statements.
+	Dialect interface {
+		// Name returns the name of the database system, e.g. "mysql".
+		Name() string
+
+		// Quote quotes an identifier, like a column name, so it can be safely
+		// used in a statement.
+		Quote(identifier string) string
+
+		// Placeholder returns the bind parameter for the nth (1-indexed)
+		// argument of a statement, e.g. `?` or `$1`.
+		Placeholder(n int) string
+
+		// IDStrategy returns how generated primary keys are retrieved after
+		// an insert.
+		IDStrategy() IDStrategy
+
+		// MaxPlaceholders returns the maximum number of bind parameters a
+		// single statement can contain.
+		MaxPlaceholders() int
+
+		// OrderedReturning reports whether a multi-row INSERT statement
+		// returns rows in the order of its VALUES, so records using the
+		// Returning strategy can be matched to the returned rows by position.
+		// When false, InsertRecords inserts such records one per statement.
+		OrderedReturning() bool
+
+		// Upsert returns the clause appended to an INSERT statement so a row
+		// conflicting on the conflict columns updates the update columns to
+		// the inserted values instead. When update is empty, the conflicting
+		// row is left as is. idColumn is the model's ID column when it's an
+		// integer, so dialects can make the ID of an updated row retrievable.
+		Upsert(idColumn string, conflict []string, update []string) string
+
+		// UpsertStrategy returns how Upsert determines whether a row was
+		// inserted or updated.
+		UpsertStrategy() UpsertStrategy
+
+		// Retryable reports whether err is a transient error, like a
+		// deadlock, after which a transaction can be retried.
+		Retryable(err error) bool
+
+		// TranslateError returns the driver error err as one of dbmap's
+		// errors, like DuplicateKeyError or an error matching ErrDeadlock,
+		// keeping err reachable using errors.As. Errors the dialect doesn't
+		// recognize are returned as is.
+		TranslateError(err error) error
+	}
+
+	// IDStrategy determines how InsertRecord retrieves generated primary keys.
+	IDStrategy int
+
+	// UpsertStrategy determines how Upsert detects whether a row was inserted
+	// or updated.
+	UpsertStrategy int
+
+	mysqlDialect    struct{}
+	mariadbDialect  struct{ mysqlDialect }
+	sqliteDialect   struct{}
+	postgresDialect struct{}
+)
+
+const (
+	// LastInsertID retrieves generated primary keys via sql.Result.LastInsertId.
+	LastInsertID IDStrategy = iota
+	// Returning retrieves generated primary keys, and columns tagged with the
+	// `default` option, by appending a RETURNING clause to the INSERT
+	// statement.
+	Returning
+)
+
+const (
+	// AffectedRows executes a single upsert statement, where an inserted row
+	// is reported as 1 affected row, like MySQL.
+	AffectedRows UpsertStrategy = iota
+	// DoNothingFirst attempts the insert while ignoring conflicts, then
+	// executes the upsert when no row was inserted, within a transaction.
+	// Used when the database can't report which path an upsert took, like
+	// SQLite.
+	DoNothingFirst
+	// ReturningXmax executes a single upsert statement returning whether the
+	// row's xmax system column is 0, which is only true for inserted rows,
+	// like PostgreSQL.
+	ReturningXmax
+)
+
+var (
+	// MySQL is the dialect for MySQL. It is the default dialect used by New.
+	MySQL Dialect = mysqlDialect{}
+	// MariaDB is the dialect for MariaDB 10.5+, which supports RETURNING.
+	MariaDB Dialect = mariadbDialect{}
+	// SQLite is the dialect for SQLite 3.35+, which supports RETURNING.
+	SQLite Dialect = sqliteDialect{}
+	// PostgreSQL is the dialect for PostgreSQL.
+	PostgreSQL Dialect = postgresDialect{}
+)
+
+func (mysqlDialect) Name() string { return "mysql" }
+
+func (mysqlDialect) Quote(identifier string) string {
+	return "`" + strings.ReplaceAll(identifier, "`", "``") + "`"
+}
+
+func (mysqlDialect) Placeholder(int) string { return "?" }
+
+func (mysqlDialect) IDStrategy() IDStrategy { return LastInsertID }
+
+func (mysqlDialect) MaxPlaceholders() int { return 65535 }
+
+// OrderedReturning returns true, since MariaDB returns the rows of a multi-row
+// INSERT in the order they were inserted.
+func (mysqlDialect) OrderedReturning() bool { return true }
+
+func (d mysqlDialect) Upsert(idColumn string, _ []string, update []string) string {
+	sets := make([]string, 0, len(update)+1)
+
+	// LAST_INSERT_ID(expr) makes the existing row's ID available via
+	// LastInsertId when the row is updated.
+	if idColumn != "" {
+		sets = append(sets, fmt.Sprintf("%s = LAST_INSERT_ID(%s)", d.Quote(idColumn), d.Quote(idColumn)))
+	}
+	for _, col := range update {
+		sets = append(sets, fmt.Sprintf("%s = VALUES(%s)", d.Quote(col), d.Quote(col)))
+	}
+
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+func (mysqlDialect) UpsertStrategy() UpsertStrategy { return AffectedRows }
+
+// Retryable returns true for deadlocks (1213) and lock wait timeouts (1205).
+func (mysqlDialect) Retryable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+
+	return mysqlErr.Number == 1213 || mysqlErr.Number == 1205
+}
+
+// TranslateError translates duplicate entries (1062), foreign key violations
+// (1216, 1217, 1451, 1452), values too long for their column (1406),
+// deadlocks (1213), and lock timeouts (1205, 3572).
+func (mysqlDialect) TranslateError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return err
+	}
+
+	switch mysqlErr.Number {
+	case 1062:
+		// MySQL 8 prefixes the index name with the table name, e.g.
+		// `users.email`.
+		index := quotedAfter(mysqlErr.Message, "for key '", '\'')
+		if _, name, ok := strings.Cut(index, "."); ok {
+			index = name
+		}
+		return &DuplicateKeyError{Index: index, Err: err}
+	case 1216, 1217, 1451, 1452:
+		return &ForeignKeyError{Constraint: quotedAfter(mysqlErr.Message, "CONSTRAINT `", '`'), Err: err}
+	case 1406:
+		return &DataTooLongError{Column: quotedAfter(mysqlErr.Message, "for column '", '\''), Err: err}
+	case 1213:
+		return &kindError{kind: ErrDeadlock, err: err}
+	case 1205, 3572:
+		return &kindError{kind: ErrLockTimeout, err: err}
+	default:
+		return err
+	}
+}
+
+func (mariadbDialect) Name() string { return "mariadb" }
+
+func (mariadbDialect) IDStrategy() IDStrategy { return Returning }
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) Quote(identifier string) string { return quoteANSI(identifier) }
+
+func (sqliteDialect) Placeholder(int) string { return "?" }
+
+func (sqliteDialect) IDStrategy() IDStrategy { return Returning }
+
+// SQLite 3.32+ defaults SQLITE_MAX_VARIABLE_NUMBER to 32766
+func (sqliteDialect) MaxPlaceholders() int { return 32766 }
+
+// OrderedReturning returns false, since SQLite documents the order of rows
+// returned by RETURNING as arbitrary.
+func (sqliteDialect) OrderedReturning() bool { return false }
+
+func (d sqliteDialect) Upsert(_ string, conflict []string, update []string) string {
+	return upsertANSI(d, conflict, update)
+}
+
+func (sqliteDialect) UpsertStrategy() UpsertStrategy { return DoNothingFirst }
+
+// Retryable returns false, since SQLite drivers don't share an error type.
+// SQLITE_BUSY is better handled with the busy_timeout pragma.
+func (sqliteDialect) Retryable(error) bool { return false }
+
+// TranslateError translates unique, primary key, and foreign key constraint
+// failures, and busy databases as lock timeouts. Since SQLite drivers don't
+// share an error type, errors are recognized by SQLite's messages.
+func (sqliteDialect) TranslateError(err error) error {
+	message := err.Error()
+
+	switch {
+	case strings.Contains(message, "UNIQUE constraint failed: "):
+		return &DuplicateKeyError{Index: constraintColumns(message, "UNIQUE constraint failed: "), Err: err}
+	case strings.Contains(message, "PRIMARY KEY constraint failed: "):
+		return &DuplicateKeyError{Index: constraintColumns(message, "PRIMARY KEY constraint failed: "), Err: err}
+	case strings.Contains(message, "FOREIGN KEY constraint failed"):
+		return &ForeignKeyError{Err: err}
+	case strings.Contains(message, "database is locked"), strings.Contains(message, "database table is locked"):
+		return &kindError{kind: ErrLockTimeout, err: err}
+	default:
+		return err
+	}
+}
+
+func (postgresDialect) Name() string { return "postgresql" }
+
+func (postgresDialect) Quote(identifier string) string { return quoteANSI(identifier) }
+
+func (postgresDialect) Placeholder(n int) string { return "$" + strconv.Itoa(n) }
+
+func (postgresDialect) IDStrategy() IDStrategy { return Returning }
+
+func (postgresDialect) MaxPlaceholders() int { return 65535 }
+
+// OrderedReturning returns true. PostgreSQL doesn't guarantee the order of
+// rows returned by RETURNING, but returns the rows of INSERT ... VALUES in the
+// order of the VALUES list, which dbmap relies on.
+func (postgresDialect) OrderedReturning() bool { return true }
+
+func (d postgresDialect) Upsert(_ string, conflict []string, update []string) string {
+	return upsertANSI(d, conflict, update)
+}
+
+func (postgresDialect) UpsertStrategy() UpsertStrategy { return ReturningXmax }
+
+// Retryable returns true for serialization failures (40001), deadlocks
+// (40P01), and lock timeouts (55P03), for drivers exposing the SQLSTATE code
+// like pgx and lib/pq.
+func (postgresDialect) Retryable(err error) bool {
+	var stateErr sqlStateError
+	if !errors.As(err, &stateErr) {
+		return false
+	}
+
+	switch stateErr.SQLState() {
+	case "40001", "40P01", "55P03":
+		return true
+	default:
+		return false
+	}
+}
+
+// TranslateError translates unique violations (23505), foreign key
+// violations (23503), values too long for their type (22001), deadlocks
+// (40P01), and lock timeouts (55P03), for drivers exposing the SQLSTATE code
+// like pgx and lib/pq.
+func (postgresDialect) TranslateError(err error) error {
+	var stateErr sqlStateError
+	if !errors.As(err, &stateErr) {
+		return err
+	}
+
+	switch stateErr.SQLState() {
+	case "23505":
+		return &DuplicateKeyError{Index: quotedAfter(stateErr.Error(), `constraint "`, '"'), Err: err}
+	case "23503":
+		return &ForeignKeyError{Constraint: quotedAfter(stateErr.Error(), `constraint "`, '"'), Err: err}
+	case "22001":
+		return &DataTooLongError{Err: err}
+	case "40P01":
+		return &kindError{kind: ErrDeadlock, err: err}
+	case "55P03":
+		return &kindError{kind: ErrLockTimeout, err: err}
+	default:
+		return err
+	}
+}
+
+// sqlStateError is implemented by errors exposing the SQLSTATE code, like
+// *pgconn.PgError and *pq.Error.
+type sqlStateError interface {
+	error
+	SQLState() string
+}
+
+// quotedAfter returns the name following prefix in message, up to the closing
+// quote, e.g. `users_email_key` in `constraint "users_email_key"` for the
+// prefix `constraint "`. It returns an empty string when prefix isn't found.
+func quotedAfter(message string, prefix string, quote byte) string {
+	_, rest, ok := strings.Cut(message, prefix)
+	if !ok {
+		return ""
+	}
+
+	name, _, _ := strings.Cut(rest, string(quote))
+	return name
+}
+
+// constraintColumns returns the columns of a SQLite constraint failure
+// following prefix, e.g. `users.email` in `UNIQUE constraint failed:
+// users.email`. Some drivers append the error code, e.g. ` (2067)`.
+func constraintColumns(message string, prefix string) string {
+	_, rest, _ := strings.Cut(message, prefix)
+	columns, _, _ := strings.Cut(rest, " (")
+
+	return strings.TrimSpace(columns)
+}
+
+// quoteANSI quotes identifiers using standard SQL double quotes.
+func quoteANSI(identifier string) string {
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
+
+// upsertANSI creates an `ON CONFLICT` clause, as used by SQLite and PostgreSQL.
+func upsertANSI(d Dialect, conflict []string, update []string) string {
+	quoted := make([]string, 0, len(conflict))
+	for _, col := range conflict {
+		quoted = append(quoted, d.Quote(col))
+	}
+
+	if len(update) == 0 {
+		return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", strings.Join(quoted, ", "))
+	}
+
+	sets := make([]string, 0, len(update))
+	for _, col := range update {
+		sets = append(sets, fmt.Sprintf("%s = excluded.%s", d.Quote(col), d.Quote(col)))
+	}
+
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(quoted, ", "), strings.Join(sets, ", "))
+}
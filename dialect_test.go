@@ -0,0 +1,232 @@
+package dbmap
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialect_Quote(t *testing.T) {
+	tests := []struct {
+		name       string
+		dialect    Dialect
+		identifier string
+		expected   string
+	}{
+		{name: "mysql", dialect: MySQL, identifier: "key", expected: "`key`"},
+		{name: "mysql escapes backticks", dialect: MySQL, identifier: "we`ird", expected: "`we``ird`"},
+		{name: "mariadb", dialect: MariaDB, identifier: "key", expected: "`key`"},
+		{name: "sqlite", dialect: SQLite, identifier: "key", expected: `"key"`},
+		{name: "sqlite escapes quotes", dialect: SQLite, identifier: `we"ird`, expected: `"we""ird"`},
+		{name: "postgresql", dialect: PostgreSQL, identifier: "key", expected: `"key"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, tt.dialect.Quote(tt.identifier))
+		})
+	}
+}
+
+func TestDialect_Placeholder(t *testing.T) {
+	require.Equal(t, "?", MySQL.Placeholder(1))
+	require.Equal(t, "?", MariaDB.Placeholder(1))
+	require.Equal(t, "?", SQLite.Placeholder(2))
+	require.Equal(t, "$1", PostgreSQL.Placeholder(1))
+	require.Equal(t, "$12", PostgreSQL.Placeholder(12))
+}
+
+func TestDialect_UpsertStrategy(t *testing.T) {
+	require.Equal(t, AffectedRows, MySQL.UpsertStrategy())
+	require.Equal(t, AffectedRows, MariaDB.UpsertStrategy())
+	require.Equal(t, DoNothingFirst, SQLite.UpsertStrategy())
+	require.Equal(t, ReturningXmax, PostgreSQL.UpsertStrategy())
+}
+
+func TestDialect_OrderedReturning(t *testing.T) {
+	require.True(t, MariaDB.OrderedReturning())
+	require.False(t, SQLite.OrderedReturning())
+	require.True(t, PostgreSQL.OrderedReturning())
+}
+
+func TestDialect_MaxPlaceholders(t *testing.T) {
+	require.Equal(t, 65535, MySQL.MaxPlaceholders())
+	require.Equal(t, 65535, MariaDB.MaxPlaceholders())
+	require.Equal(t, 32766, SQLite.MaxPlaceholders())
+	require.Equal(t, 65535, PostgreSQL.MaxPlaceholders())
+}
+
+func TestDialect_Upsert(t *testing.T) {
+	tests := []struct {
+		name     string
+		dialect  Dialect
+		idColumn string
+		conflict []string
+		update   []string
+		expected string
+	}{
+		{
+			name:     "mysql",
+			dialect:  MySQL,
+			idColumn: "id",
+			conflict: []string{"key"},
+			update:   []string{"value", "updated_at"},
+			expected: "ON DUPLICATE KEY UPDATE `id` = LAST_INSERT_ID(`id`), `value` = VALUES(`value`), `updated_at` = VALUES(`updated_at`)",
+		},
+		{
+			name:     "mysql without ID",
+			dialect:  MySQL,
+			update:   []string{"value"},
+			expected: "ON DUPLICATE KEY UPDATE `value` = VALUES(`value`)",
+		},
+		{
+			name:     "sqlite",
+			dialect:  SQLite,
+			idColumn: "id",
+			conflict: []string{"team_id", "user_id"},
+			update:   []string{"role"},
+			expected: `ON CONFLICT ("team_id", "user_id") DO UPDATE SET "role" = excluded."role"`,
+		},
+		{
+			name:     "postgresql without updates",
+			dialect:  PostgreSQL,
+			idColumn: "id",
+			conflict: []string{"key"},
+			expected: `ON CONFLICT ("key") DO NOTHING`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, tt.dialect.Upsert(tt.idColumn, tt.conflict, tt.update))
+		})
+	}
+}
+
+type testSQLStateError string
+
+func (e testSQLStateError) Error() string    { return "sqlstate " + string(e) }
+func (e testSQLStateError) SQLState() string { return string(e) }
+
+func TestDialect_Retryable(t *testing.T) {
+	tests := []struct {
+		name     string
+		dialect  Dialect
+		err      error
+		expected bool
+	}{
+		{name: "mysql deadlock", dialect: MySQL, err: &mysql.MySQLError{Number: 1213}, expected: true},
+		{name: "mysql lock wait timeout", dialect: MySQL, err: &mysql.MySQLError{Number: 1205}, expected: true},
+		{name: "mysql wrapped deadlock", dialect: MySQL, err: fmt.Errorf("failed: %w", &mysql.MySQLError{Number: 1213}), expected: true},
+		{name: "mysql duplicate key", dialect: MySQL, err: &mysql.MySQLError{Number: 1062}, expected: false},
+		{name: "mariadb deadlock", dialect: MariaDB, err: &mysql.MySQLError{Number: 1213}, expected: true},
+		{name: "mysql other error", dialect: MySQL, err: errors.New("boom"), expected: false},
+		{name: "postgresql serialization failure", dialect: PostgreSQL, err: testSQLStateError("40001"), expected: true},
+		{name: "postgresql deadlock", dialect: PostgreSQL, err: fmt.Errorf("failed: %w", testSQLStateError("40P01")), expected: true},
+		{name: "postgresql unique violation", dialect: PostgreSQL, err: testSQLStateError("23505"), expected: false},
+		{name: "sqlite", dialect: SQLite, err: testSQLStateError("40001"), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, tt.dialect.Retryable(tt.err))
+		})
+	}
+}
+
+type testPgError struct {
+	code    string
+	message string
+}
+
+func (e testPgError) Error() string    { return "ERROR: " + e.message + " (SQLSTATE " + e.code + ")" }
+func (e testPgError) SQLState() string { return e.code }
+
+func TestDialect_TranslateError(t *testing.T) {
+	tests := []struct {
+		name     string
+		dialect  Dialect
+		err      error
+		expected error
+	}{
+		{
+			name:     "mysql duplicate entry",
+			dialect:  MySQL,
+			err:      &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'fox@fbi.gov' for key 'users.index_users_on_email'"},
+			expected: &DuplicateKeyError{Index: "index_users_on_email"},
+		},
+		{
+			name:     "mysql 5.7 duplicate entry",
+			dialect:  MySQL,
+			err:      &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"},
+			expected: &DuplicateKeyError{Index: "PRIMARY"},
+		},
+		{
+			name:     "mysql foreign key",
+			dialect:  MySQL,
+			err:      &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails (`app`.`posts`, CONSTRAINT `fk_posts_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`))"},
+			expected: &ForeignKeyError{Constraint: "fk_posts_user"},
+		},
+		{
+			name:     "mysql data too long",
+			dialect:  MySQL,
+			err:      &mysql.MySQLError{Number: 1406, Message: "Data too long for column 'name' at row 1"},
+			expected: &DataTooLongError{Column: "name"},
+		},
+		{name: "mysql deadlock", dialect: MySQL, err: &mysql.MySQLError{Number: 1213}, expected: &kindError{kind: ErrDeadlock}},
+		{name: "mysql lock wait timeout", dialect: MySQL, err: &mysql.MySQLError{Number: 1205}, expected: &kindError{kind: ErrLockTimeout}},
+		{name: "mariadb deadlock", dialect: MariaDB, err: &mysql.MySQLError{Number: 1213}, expected: &kindError{kind: ErrDeadlock}},
+		{name: "mysql other error", dialect: MySQL, err: &mysql.MySQLError{Number: 1146}, expected: nil},
+		{
+			name:     "postgresql unique violation",
+			dialect:  PostgreSQL,
+			err:      testPgError{code: "23505", message: `duplicate key value violates unique constraint "users_email_key"`},
+			expected: &DuplicateKeyError{Index: "users_email_key"},
+		},
+		{
+			name:     "postgresql foreign key violation",
+			dialect:  PostgreSQL,
+			err:      testPgError{code: "23503", message: `insert or update on table "posts" violates foreign key constraint "posts_user_id_fkey"`},
+			expected: &ForeignKeyError{Constraint: "posts_user_id_fkey"},
+		},
+		{name: "postgresql value too long", dialect: PostgreSQL, err: testSQLStateError("22001"), expected: &DataTooLongError{}},
+		{name: "postgresql deadlock", dialect: PostgreSQL, err: testSQLStateError("40P01"), expected: &kindError{kind: ErrDeadlock}},
+		{name: "postgresql lock timeout", dialect: PostgreSQL, err: testSQLStateError("55P03"), expected: &kindError{kind: ErrLockTimeout}},
+		{name: "postgresql other error", dialect: PostgreSQL, err: testSQLStateError("40001"), expected: nil},
+		{name: "sqlite unique", dialect: SQLite, err: errors.New("UNIQUE constraint failed: users.email"), expected: &DuplicateKeyError{Index: "users.email"}},
+		{name: "sqlite unique with code", dialect: SQLite, err: errors.New("constraint failed: UNIQUE constraint failed: users.a, users.b (2067)"), expected: &DuplicateKeyError{Index: "users.a, users.b"}},
+		{name: "sqlite primary key", dialect: SQLite, err: errors.New("PRIMARY KEY constraint failed: users.id"), expected: &DuplicateKeyError{Index: "users.id"}},
+		{name: "sqlite foreign key", dialect: SQLite, err: errors.New("FOREIGN KEY constraint failed"), expected: &ForeignKeyError{}},
+		{name: "sqlite busy", dialect: SQLite, err: errors.New("database is locked"), expected: &kindError{kind: ErrLockTimeout}},
+		{name: "sqlite other error", dialect: SQLite, err: errors.New("no such table: users"), expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fmt.Errorf("failed to execute insert: %w", tt.err)
+			translated := tt.dialect.TranslateError(err)
+
+			switch expected := tt.expected.(type) {
+			case nil:
+				require.Same(t, err, translated)
+			case *DuplicateKeyError:
+				expected.Err = err
+				require.Equal(t, expected, translated)
+			case *ForeignKeyError:
+				expected.Err = err
+				require.Equal(t, expected, translated)
+			case *DataTooLongError:
+				expected.Err = err
+				require.Equal(t, expected, translated)
+			case *kindError:
+				expected.err = err
+				require.Equal(t, expected, translated)
+			}
+
+			require.ErrorIs(t, translated, tt.err, "the driver error stays reachable")
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package dbmap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type (
+	// DuplicateKeyError is returned when a statement violates a unique index,
+	// including the primary key. It matches ErrDuplicateKey using errors.Is,
+	// and unwraps to the driver's error.
+	DuplicateKeyError struct {
+		// Index is the name of the violated index or constraint, e.g.
+		// `users_email_key`. SQLite doesn't report index names, so it is the
+		// conflicting columns instead, e.g. `users.email`.
+		Index string
+		// Err is the driver's error.
+		Err error
+	}
+
+	// ForeignKeyError is returned when a statement violates a foreign key
+	// constraint. It matches ErrForeignKey using errors.Is, and unwraps to the
+	// driver's error.
+	ForeignKeyError struct {
+		// Constraint is the name of the violated constraint. Empty when the
+		// database doesn't report it, like SQLite.
+		Constraint string
+		// Err is the driver's error.
+		Err error
+	}
+
+	// DataTooLongError is returned when a value is too long for its column.
+	// It matches ErrDataTooLong using errors.Is, and unwraps to the driver's
+	// error.
+	DataTooLongError struct {
+		// Column is the column the value is too long for. Empty when the
+		// database doesn't report it, like PostgreSQL.
+		Column string
+		// Err is the driver's error.
+		Err error
+	}
+
+	// kindError is a driver error matching a sentinel error, like
+	// ErrDeadlock, using errors.Is.
+	kindError struct {
+		kind error
+		err  error
+	}
+)
+
+var (
+	// ErrNotFound is returned when no record is found. It is sql.ErrNoRows,
+	// so comparisons against either keep working.
+	ErrNotFound = sql.ErrNoRows
+
+	// ErrDuplicateKey is matched by DuplicateKeyError.
+	ErrDuplicateKey = errors.New("duplicate key")
+	// ErrForeignKey is matched by ForeignKeyError.
+	ErrForeignKey = errors.New("foreign key violation")
+	// ErrDataTooLong is matched by DataTooLongError.
+	ErrDataTooLong = errors.New("data too long")
+	// ErrDeadlock is matched by errors of statements or transactions aborted
+	// by the database to resolve a deadlock.
+	ErrDeadlock = errors.New("deadlock")
+	// ErrLockTimeout is matched by errors of statements that timed out
+	// waiting for a lock.
+	ErrLockTimeout = errors.New("lock timeout")
+)
+
+// Error returns the driver's error message, so translating errors doesn't
+// change them.
+func (e *DuplicateKeyError) Error() string { return e.Err.Error() }
+
+func (e *DuplicateKeyError) Is(target error) bool { return target == ErrDuplicateKey }
+
+func (e *DuplicateKeyError) Unwrap() error { return e.Err }
+
+// Error returns the driver's error message.
+func (e *ForeignKeyError) Error() string { return e.Err.Error() }
+
+func (e *ForeignKeyError) Is(target error) bool { return target == ErrForeignKey }
+
+func (e *ForeignKeyError) Unwrap() error { return e.Err }
+
+// Error returns the driver's error message.
+func (e *DataTooLongError) Error() string { return e.Err.Error() }
+
+func (e *DataTooLongError) Is(target error) bool { return target == ErrDataTooLong }
+
+func (e *DataTooLongError) Unwrap() error { return e.Err }
+
+func (e *kindError) Error() string { return e.err.Error() }
+
+func (e *kindError) Is(target error) bool { return target == e.kind }
+
+func (e *kindError) Unwrap() error { return e.err }
+
+// translateErrors wraps handler to translate the driver errors it returns, so
+// interceptors and callers receive dbmap's errors.
+func (d *DB) translateErrors(handler Handler) Handler {
+	return func(ctx context.Context, stmt *Statement) (Result, error) {
+		result, err := handler(ctx, stmt)
+		return result, d.translateError(err)
+	}
+}
+
+// translateError returns err translated by the dialect into one of dbmap's
+// errors, like DuplicateKeyError, or err when it isn't a known driver error
+// or was already translated.
+func (d *DB) translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	for _, translated := range []error{ErrDuplicateKey, ErrForeignKey, ErrDataTooLong, ErrDeadlock, ErrLockTimeout} {
+		if errors.Is(err, translated) {
+			return err
+		}
+	}
+
+	return d.dialect().TranslateError(err)
+}
@@ -0,0 +1,69 @@
+package dbmap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrors(t *testing.T) {
+	driverErr := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'users.email'"}
+
+	var err error = &DuplicateKeyError{Index: "email", Err: driverErr}
+	require.ErrorIs(t, err, ErrDuplicateKey)
+	require.NotErrorIs(t, err, ErrForeignKey)
+	require.Equal(t, driverErr.Error(), err.Error())
+
+	var mysqlErr *mysql.MySQLError
+	require.ErrorAs(t, err, &mysqlErr)
+	require.Same(t, driverErr, mysqlErr)
+
+	err = &kindError{kind: ErrDeadlock, err: driverErr}
+	require.ErrorIs(t, err, ErrDeadlock)
+	require.NotErrorIs(t, err, ErrLockTimeout)
+
+	require.ErrorIs(t, ErrNotFound, sql.ErrNoRows)
+}
+
+func TestDB_translateErrors(t *testing.T) {
+	db := &DB{}
+
+	t.Run("translates driver errors of statements", func(t *testing.T) {
+		_, err := db.execute(context.Background(), &Statement{}, func(context.Context, *Statement) (Result, error) {
+			return Result{}, &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+		})
+
+		require.ErrorIs(t, err, ErrDeadlock)
+		require.ErrorAs(t, err, new(*mysql.MySQLError))
+	})
+
+	t.Run("interceptors receive translated errors", func(t *testing.T) {
+		db := &DB{Interceptors: []Interceptor{
+			func(ctx context.Context, stmt *Statement, next Handler) (Result, error) {
+				result, err := next(ctx, stmt)
+				require.ErrorIs(t, err, ErrLockTimeout)
+				return result, err
+			},
+		}}
+
+		_, err := db.execute(context.Background(), &Statement{}, func(context.Context, *Statement) (Result, error) {
+			return Result{}, &mysql.MySQLError{Number: 1205}
+		})
+		require.ErrorIs(t, err, ErrLockTimeout)
+	})
+
+	t.Run("doesn't translate errors twice", func(t *testing.T) {
+		err := &DuplicateKeyError{Index: "email", Err: &mysql.MySQLError{Number: 1062}}
+		require.Same(t, err, db.translateError(err))
+	})
+
+	t.Run("returns other errors as is", func(t *testing.T) {
+		err := errors.New("boom")
+		require.Same(t, err, db.translateError(err))
+		require.NoError(t, db.translateError(nil))
+	})
+}
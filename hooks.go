@@ -0,0 +1,162 @@
+package dbmap
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+type (
+	// BeforeInsertHook is implemented by models that run logic before being
+	// inserted by InsertRecord or InsertRecords, e.g. to normalize fields.
+	// Returning an error aborts the insert.
+	BeforeInsertHook interface {
+		BeforeInsert(ctx context.Context, db *DB) error
+	}
+
+	// AfterInsertHook is implemented by models that run logic after being
+	// inserted by InsertRecord or InsertRecords. Returning an error rolls back
+	// the insert.
+	AfterInsertHook interface {
+		AfterInsert(ctx context.Context, db *DB) error
+	}
+
+	// BeforeUpdateHook is implemented by models that run logic before being
+	// updated by UpdateRecord. The hook receives a copy of the updates, which
+	// it can modify. Returning an error aborts the update.
+	BeforeUpdateHook interface {
+		BeforeUpdate(ctx context.Context, db *DB, updates Updates) error
+	}
+
+	// AfterFindHook is implemented by models that run logic after being
+	// scanned by Select or SelectIter, e.g. to decrypt fields. Returning an
+	// error aborts the select.
+	//
+	// SelectIter calls the hook while the rows are still open, so it must not
+	// query the database when iterating within a transaction.
+	AfterFindHook interface {
+		AfterFind(ctx context.Context, db *DB) error
+	}
+
+	// BeforeDeleteHook is implemented by models that run logic before being
+	// deleted by DeleteRecord or DeleteRecords. Returning an error aborts the
+	// delete.
+	BeforeDeleteHook interface {
+		BeforeDelete(ctx context.Context, db *DB) error
+	}
+
+	// hooks records which hooks a model implements.
+	hooks struct {
+		beforeInsert bool
+		afterInsert  bool
+		beforeUpdate bool
+		afterFind    bool
+		beforeDelete bool
+	}
+)
+
+// findHooks returns the hooks implemented by a pointer to elem, which includes
+// hooks implemented with value receivers.
+func findHooks(elem reflect.Type) hooks {
+	ptr := reflect.PointerTo(elem)
+
+	return hooks{
+		beforeInsert: ptr.Implements(reflect.TypeFor[BeforeInsertHook]()),
+		afterInsert:  ptr.Implements(reflect.TypeFor[AfterInsertHook]()),
+		beforeUpdate: ptr.Implements(reflect.TypeFor[BeforeUpdateHook]()),
+		afterFind:    ptr.Implements(reflect.TypeFor[AfterFindHook]()),
+		beforeDelete: ptr.Implements(reflect.TypeFor[BeforeDeleteHook]()),
+	}
+}
+
+// hook returns the addressable struct value as the hook interface H.
+func hook[H any](value reflect.Value) H {
+	return value.Addr().Interface().(H)
+}
+
+// hookContext returns the context passed to hooks, which carries the
+// transaction so hooks using the root DB join it.
+func (d *DB) hookContext(ctx context.Context) context.Context {
+	if d.tx == nil {
+		return ctx
+	}
+
+	return WithTx(ctx, d)
+}
+
+// beforeInsert calls the BeforeInsert hook of each value, if implemented.
+func (d *DB) beforeInsert(ctx context.Context, model *modelType, values ...reflect.Value) error {
+	if !model.hooks.beforeInsert {
+		return nil
+	}
+
+	ctx = d.hookContext(ctx)
+	for _, value := range values {
+		if err := hook[BeforeInsertHook](value).BeforeInsert(ctx, d); err != nil {
+			return fmt.Errorf("failed to run BeforeInsert hook: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// afterInsert calls the AfterInsert hook of each value, if implemented.
+func (d *DB) afterInsert(ctx context.Context, model *modelType, values ...reflect.Value) error {
+	if !model.hooks.afterInsert {
+		return nil
+	}
+
+	ctx = d.hookContext(ctx)
+	for _, value := range values {
+		if err := hook[AfterInsertHook](value).AfterInsert(ctx, d); err != nil {
+			return fmt.Errorf("failed to run AfterInsert hook: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// beforeUpdate calls the BeforeUpdate hook of the value, if implemented.
+func (d *DB) beforeUpdate(ctx context.Context, model *modelType, value reflect.Value, updates Updates) error {
+	if !model.hooks.beforeUpdate {
+		return nil
+	}
+
+	if err := hook[BeforeUpdateHook](value).BeforeUpdate(d.hookContext(ctx), d, updates); err != nil {
+		return fmt.Errorf("failed to run BeforeUpdate hook: %w", err)
+	}
+
+	return nil
+}
+
+// afterFind calls the AfterFind hook of each value, if implemented.
+func (d *DB) afterFind(ctx context.Context, model *modelType, values ...reflect.Value) error {
+	if !model.hooks.afterFind {
+		return nil
+	}
+
+	ctx = d.hookContext(ctx)
+	for _, value := range values {
+		if err := hook[AfterFindHook](value).AfterFind(ctx, d); err != nil {
+			return fmt.Errorf("failed to run AfterFind hook: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// beforeDelete calls the BeforeDelete hook of each value, if implemented.
+func (d *DB) beforeDelete(ctx context.Context, model *modelType, values ...reflect.Value) error {
+	if !model.hooks.beforeDelete {
+		return nil
+	}
+
+	ctx = d.hookContext(ctx)
+	for _, value := range values {
+		if err := hook[BeforeDeleteHook](value).BeforeDelete(ctx, d); err != nil {
+			return fmt.Errorf("failed to run BeforeDelete hook: %w", err)
+		}
+	}
+
+	return nil
+}
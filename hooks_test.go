@@ -0,0 +1,43 @@
+package dbmap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type valueHookModel struct {
+	ID int `db:"id"`
+}
+
+func (valueHookModel) AfterFind(context.Context, *DB) error { return nil }
+
+type pointerHookModel struct {
+	ID int `db:"id"`
+}
+
+func (*pointerHookModel) BeforeInsert(context.Context, *DB) error { return nil }
+
+func (*pointerHookModel) BeforeUpdate(context.Context, *DB, Updates) error { return nil }
+
+func TestFindHooks(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    any
+		expected hooks
+	}{
+		{name: "no hooks", model: &struct{ ID int }{}, expected: hooks{}},
+		{name: "value receivers", model: &valueHookModel{}, expected: hooks{afterFind: true}},
+		{name: "pointer receivers", model: &pointerHookModel{}, expected: hooks{beforeInsert: true, beforeUpdate: true}},
+		{name: "slice of structs", model: &[]pointerHookModel{}, expected: hooks{beforeInsert: true, beforeUpdate: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := newModelType(tt.model, defaultPluralizer)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, model.hooks)
+		})
+	}
+}
@@ -1,14 +1,18 @@
 package dbmap
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/require"
 )
 
@@ -58,6 +62,106 @@ func (n *NullTimeKeyValue) TableName() string {
 	return "key_values"
 }
 
+type DefaultActiveUser struct {
+	ID     int    `db:"id"`
+	Name   string `db:"name"`
+	Email  string `db:"email"`
+	Active *bool  `db:"active,default"`
+}
+
+func (u *DefaultActiveUser) TableName() string {
+	return "users"
+}
+
+type Session struct {
+	Token     string    `db:"token,pk"`
+	UserID    int       `db:"user_id"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+type TeamMembership struct {
+	TeamID int    `db:"team_id,pk"`
+	UserID int    `db:"user_id,pk"`
+	Role   string `db:"role"`
+}
+
+type HookedUser struct {
+	ID      int    `db:"id"`
+	Name    string `db:"name"`
+	Email   string `db:"email"`
+	Display string `db:"-"`
+}
+
+func (u *HookedUser) TableName() string {
+	return "users"
+}
+
+func (u *HookedUser) BeforeInsert(ctx context.Context, db *DB) error {
+	u.Email = strings.ToLower(u.Email)
+	return nil
+}
+
+func (u *HookedUser) AfterInsert(ctx context.Context, db *DB) error {
+	if u.Name == "" {
+		return errors.New("name is required")
+	}
+	return db.InsertRecord(ctx, &KeyValue{Key: fmt.Sprintf("user.%d.created", u.ID), Value: u.Email})
+}
+
+func (u *HookedUser) BeforeUpdate(ctx context.Context, db *DB, updates Updates) error {
+	if email, ok := updates["Email"].(string); ok {
+		updates["Email"] = strings.ToLower(email)
+	}
+	return nil
+}
+
+func (u *HookedUser) AfterFind(ctx context.Context, db *DB) error {
+	u.Display = fmt.Sprintf("%s <%s>", u.Name, u.Email)
+	return nil
+}
+
+func (u *HookedUser) BeforeDelete(ctx context.Context, db *DB) error {
+	if u.Name == "protected" {
+		return errors.New("protected users can't be deleted")
+	}
+	return nil
+}
+
+type ValidatedUser struct {
+	ID    int    `db:"id"`
+	Name  string `db:"name" validate:"required,max=10"`
+	Email string `db:"email" validate:"required"`
+}
+
+func (u *ValidatedUser) TableName() string {
+	return "users"
+}
+
+type NormalizedUser struct {
+	ID    int    `db:"id"`
+	Name  string `db:"name" validate:"required,max=10"`
+	Email string `db:"email" validate:"required"`
+}
+
+func (u *NormalizedUser) TableName() string {
+	return "users"
+}
+
+func (u *NormalizedUser) BeforeInsert(ctx context.Context, db *DB) error {
+	if u.Name == "" {
+		u.Name, _, _ = strings.Cut(u.Email, "@")
+	}
+	return nil
+}
+
+func (u *NormalizedUser) BeforeUpdate(ctx context.Context, db *DB, updates Updates) error {
+	if email, ok := updates["Email"].(string); ok {
+		updates["Name"], _, _ = strings.Cut(email, "@")
+	}
+	return nil
+}
+
 func setupDB(t *testing.T) *sql.DB {
 	host := getEnv("MYSQL_HOST", "localhost")
 	port := getEnv("MYSQL_PORT", "3306")
@@ -173,6 +277,34 @@ func TestSelect(t *testing.T) {
 		requireKVsEqual(t, expectedKVs, kvs)
 	})
 
+	t.Run("select with slice expanded into IN clause", func(t *testing.T) {
+		var kvs []KeyValue
+		err := db.Select(ctx, &kvs, "WHERE `key` IN ($keys) ORDER BY `key`", Args{
+			"keys": []string{"config.app.name", "config.database.port"},
+		})
+
+		require.NoError(t, err)
+
+		expectedKVs := []KeyValue{
+			{ID: 3, Key: "config.app.name", Value: "MicroORM"},
+			{ID: 2, Key: "config.database.port", Value: "3306"},
+		}
+		requireKVsEqual(t, expectedKVs, kvs)
+	})
+
+	t.Run("select with empty slice", func(t *testing.T) {
+		var kvs []KeyValue
+		err := db.Select(ctx, &kvs, "WHERE id IN ($ids)", Args{"ids": []int{}})
+		require.ErrorIs(t, err, ErrEmptySlice)
+
+		db := New(sqlDB)
+		db.AllowEmptySlices = true
+
+		err = db.Select(ctx, &kvs, "WHERE id IN ($ids)", Args{"ids": []int{}})
+		require.NoError(t, err)
+		require.Empty(t, kvs)
+	})
+
 	t.Run("select non-existent key", func(t *testing.T) {
 		var kv KeyValue
 		err := db.Select(ctx, &kv, "WHERE `key` = $key", Args{
@@ -184,6 +316,78 @@ func TestSelect(t *testing.T) {
 	})
 }
 
+func TestSelectIter(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := setupDB(t)
+	db := New(sqlDB)
+
+	t.Run("iterates over all rows", func(t *testing.T) {
+		var kvs []KeyValue
+		for kv, err := range SelectIter[KeyValue](ctx, db, "WHERE `key` LIKE $pattern ORDER BY `key`", Args{
+			"pattern": "config.database.%",
+		}) {
+			require.NoError(t, err)
+			kvs = append(kvs, *kv)
+		}
+
+		expectedKVs := []KeyValue{
+			{ID: 1, Key: "config.database.host", Value: "localhost"},
+			{ID: 2, Key: "config.database.port", Value: "3306"},
+		}
+		requireKVsEqual(t, expectedKVs, kvs)
+	})
+
+	t.Run("closes rows when stopping early", func(t *testing.T) {
+		// A single connection means a leaked *sql.Rows would block the
+		// following query.
+		sqlDB.SetMaxOpenConns(1)
+		t.Cleanup(func() { sqlDB.SetMaxOpenConns(0) })
+
+		var seen int
+		for _, err := range SelectIter[KeyValue](ctx, db, "ORDER BY `key`", nil) {
+			require.NoError(t, err)
+			seen++
+			break
+		}
+		require.Equal(t, 1, seen)
+
+		var kvs []KeyValue
+		err := db.Select(ctx, &kvs, "", nil)
+		require.NoError(t, err)
+		require.Len(t, kvs, 5)
+	})
+
+	t.Run("yields query errors", func(t *testing.T) {
+		var errs []error
+		for kv, err := range SelectIter[KeyValue](ctx, db, "WHERE nonexistent_column = 1", nil) {
+			require.Nil(t, kv)
+			errs = append(errs, err)
+		}
+
+		require.Len(t, errs, 1)
+		require.ErrorContains(t, errs[0], "failed to execute Select query")
+	})
+
+	t.Run("excludes the loop from the statement's duration", func(t *testing.T) {
+		var metrics MetricsCollector
+		db := New(sqlDB)
+		db.Metrics = &metrics
+		db.SlowQueryThreshold = 100 * time.Millisecond
+		db.OnSlowQuery = func(_ context.Context, query SlowQuery) {
+			t.Errorf("the loop was reported as a slow statement: %s", query.Duration)
+		}
+
+		for _, err := range SelectIter[KeyValue](ctx, db, "ORDER BY `key`", nil) {
+			require.NoError(t, err)
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		stats := metrics.Snapshot()
+		require.Len(t, stats, 1)
+		require.Less(t, stats[0].Latency.Sum, 100*time.Millisecond)
+	})
+}
+
 func TestInsert(t *testing.T) {
 	ctx := context.Background()
 	sqlDB := setupDB(t)
@@ -236,245 +440,1219 @@ func TestInsert(t *testing.T) {
 		require.Equal(t, kv.Value, retrievedKV.Value)
 	})
 
-	t.Run("insert automatically sets CreatedAt field", func(t *testing.T) {
-		insertTime := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
-		mockClock := newMockClock(insertTime)
+	t.Run("insert automatically sets CreatedAt field", func(t *testing.T) {
+		insertTime := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+		mockClock := newMockClock(insertTime)
+
+		db := &DB{
+			db:             db.db,
+			modelTypeCache: db.modelTypeCache,
+			Pluralizer:     db.Pluralizer,
+			time:           mockClock,
+		}
+
+		kv := &KeyValue{
+			Key:   "test.insert.createdat",
+			Value: "test created at",
+		}
+
+		require.True(t, kv.CreatedAt.IsZero(), "CreatedAt should be zero before insert")
+
+		err := db.InsertRecord(ctx, kv)
+		require.NoError(t, err)
+
+		require.False(t, kv.CreatedAt.IsZero(), "CreatedAt should not be zero after insert")
+		require.Equal(t, insertTime, kv.CreatedAt, "CreatedAt should match the mock time")
+		require.Equal(t, insertTime, kv.UpdatedAt, "UpdatedAt should match the mock time")
+
+		var retrievedKV KeyValue
+		err = db.Select(ctx, &retrievedKV, "WHERE `key` = $key", Args{"key": "test.insert.createdat"})
+		require.NoError(t, err)
+		require.WithinDuration(t, kv.CreatedAt, retrievedKV.CreatedAt, time.Second, "CreatedAt should match between struct and database within 1 second")
+	})
+
+	t.Run("omits zero valued default columns", func(t *testing.T) {
+		user := &DefaultActiveUser{
+			Name:  "Walter Skinner",
+			Email: "skinner@fbi.gov",
+		}
+
+		err := db.InsertRecord(ctx, user)
+		require.NoError(t, err)
+		require.NotEqual(t, 0, user.ID)
+
+		var retrievedUser DefaultActiveUser
+		err = db.Select(ctx, &retrievedUser, "WHERE id = $id", Args{"id": user.ID})
+		require.NoError(t, err)
+		require.NotNil(t, retrievedUser.Active)
+		require.True(t, *retrievedUser.Active, "Active should use the database default")
+	})
+
+	t.Run("inserts zero values of default columns given as pointers", func(t *testing.T) {
+		active := false
+		user := &DefaultActiveUser{
+			Name:   "Alex Krycek",
+			Email:  "krycek@fbi.gov",
+			Active: &active,
+		}
+
+		err := db.InsertRecord(ctx, user)
+		require.NoError(t, err)
+
+		var retrievedUser DefaultActiveUser
+		err = db.Select(ctx, &retrievedUser, "WHERE id = $id", Args{"id": user.ID})
+		require.NoError(t, err)
+		require.NotNil(t, retrievedUser.Active)
+		require.False(t, *retrievedUser.Active)
+	})
+}
+
+func TestInsertRecords(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := setupDB(t)
+	db := New(sqlDB)
+
+	t.Run("inserts records and populates IDs", func(t *testing.T) {
+		kvs := []KeyValue{
+			{Key: "test.bulk.1", Value: "first"},
+			{Key: "test.bulk.2", Value: "second"},
+			{Key: "test.bulk.3", Value: "third"},
+		}
+
+		err := db.InsertRecords(ctx, kvs)
+		require.NoError(t, err)
+
+		for i := range kvs {
+			require.NotEqual(t, 0, kvs[i].ID)
+			require.False(t, kvs[i].CreatedAt.IsZero())
+			require.False(t, kvs[i].UpdatedAt.IsZero())
+		}
+		require.Equal(t, kvs[0].ID+1, kvs[1].ID)
+		require.Equal(t, kvs[1].ID+1, kvs[2].ID)
+
+		var retrievedKVs []KeyValue
+		err = db.Select(ctx, &retrievedKVs, "WHERE `key` LIKE $pattern ORDER BY `key`", Args{
+			"pattern": "test.bulk.%",
+		})
+		require.NoError(t, err)
+		requireKVsEqual(t, kvs, retrievedKVs)
+	})
+
+	t.Run("inserts slices of pointers with pre-populated IDs", func(t *testing.T) {
+		kvs := []*KeyValue{
+			{Key: "test.bulk.pointer.1", Value: "first"},
+			{ID: 500, Key: "test.bulk.pointer.2", Value: "second"},
+			{Key: "test.bulk.pointer.3", Value: "third"},
+		}
+
+		err := db.InsertRecords(ctx, kvs)
+		require.NoError(t, err)
+
+		require.NotEqual(t, 0, kvs[0].ID)
+		require.Equal(t, 500, kvs[1].ID)
+		require.NotEqual(t, 0, kvs[2].ID)
+
+		var retrievedKVs []*KeyValue
+		err = db.Select(ctx, &retrievedKVs, "WHERE `key` LIKE $pattern ORDER BY `key`", Args{
+			"pattern": "test.bulk.pointer.%",
+		})
+		require.NoError(t, err)
+		requireKVsEqual(t, kvs, retrievedKVs)
+	})
+
+	t.Run("rolls back all records on failure", func(t *testing.T) {
+		kvs := []KeyValue{
+			{Key: "test.bulk.duplicate.1", Value: "first"},
+			{ID: 501, Key: "test.bulk.duplicate.2", Value: "second"},
+			{Key: "config.app.name", Value: "duplicate"},
+		}
+
+		err := db.InsertRecords(ctx, kvs)
+		require.Error(t, err)
+
+		count, err := db.Count(ctx, &KeyValue{}, "WHERE `key` LIKE $pattern", Args{
+			"pattern": "test.bulk.duplicate.%",
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(0), count)
+	})
+
+	t.Run("empty slices are a no-op", func(t *testing.T) {
+		err := db.InsertRecords(ctx, []KeyValue{})
+		require.NoError(t, err)
+	})
+}
+
+func TestUpsert(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := setupDB(t)
+	db := New(sqlDB)
+
+	t.Run("inserts new records", func(t *testing.T) {
+		kv := &KeyValue{Key: "test.upsert.new", Value: "inserted"}
+
+		inserted, err := db.Upsert(ctx, kv, []string{"Key"}, []string{"Value"})
+		require.NoError(t, err)
+		require.True(t, inserted)
+		require.NotEqual(t, 0, kv.ID)
+
+		var retrievedKV KeyValue
+		err = db.Select(ctx, &retrievedKV, "WHERE `key` = $key", Args{"key": "test.upsert.new"})
+		require.NoError(t, err)
+		requireKVEqual(t, *kv, retrievedKV)
+	})
+
+	t.Run("updates existing records", func(t *testing.T) {
+		insertTime := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+		mockClock := newMockClock(insertTime)
+		db := New(sqlDB)
+		db.time = mockClock
+
+		original := &KeyValue{Key: "test.upsert.existing", Value: "original"}
+		err := db.InsertRecord(ctx, original)
+		require.NoError(t, err)
+
+		mockClock.Advance(time.Hour)
+
+		kv := &KeyValue{Key: "test.upsert.existing", Value: "updated"}
+		inserted, err := db.Upsert(ctx, kv, []string{"key"}, []string{"value", "created_at"})
+		require.NoError(t, err)
+		require.False(t, inserted)
+		require.Equal(t, original.ID, kv.ID, "ID of the existing row should be populated")
+		require.Equal(t, insertTime, kv.CreatedAt.UTC(), "CreatedAt of the struct should be the preserved value")
+
+		var retrievedKV KeyValue
+		err = db.Select(ctx, &retrievedKV, "WHERE `key` = $key", Args{"key": "test.upsert.existing"})
+		require.NoError(t, err)
+		require.Equal(t, "updated", retrievedKV.Value)
+		require.Equal(t, insertTime, retrievedKV.CreatedAt.UTC(), "CreatedAt should be preserved")
+		require.Equal(t, insertTime.Add(time.Hour), retrievedKV.UpdatedAt.UTC(), "UpdatedAt should be touched")
+	})
+
+	t.Run("updates existing records with string primary keys", func(t *testing.T) {
+		require.NoError(t, db.InsertRecord(ctx, &Session{Token: "upsert-token", UserID: 1}))
+
+		session := &Session{Token: "upsert-token", UserID: 2}
+		inserted, err := db.Upsert(ctx, session, []string{"token"}, []string{"user_id"})
+		require.NoError(t, err)
+		require.False(t, inserted)
+		require.Equal(t, "upsert-token", session.Token)
+
+		var retrieved Session
+		err = db.Select(ctx, &retrieved, "WHERE token = $token", Args{"token": "upsert-token"})
+		require.NoError(t, err)
+		require.Equal(t, 2, retrieved.UserID)
+	})
+
+	t.Run("unknown columns return an error", func(t *testing.T) {
+		_, err := db.Upsert(ctx, &KeyValue{Key: "test.upsert.unknown"}, []string{"key"}, []string{"Missing"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unknown column: Missing")
+	})
+}
+
+func TestCustomPrimaryKey(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := setupDB(t)
+	db := New(sqlDB)
+
+	session := &Session{Token: "abc123", UserID: 1}
+	err := db.InsertRecord(ctx, session)
+	require.NoError(t, err)
+	require.Equal(t, "abc123", session.Token)
+
+	other := &Session{Token: "def456", UserID: 2}
+	err = db.InsertRecord(ctx, other)
+	require.NoError(t, err)
+
+	t.Run("updates by the primary key column", func(t *testing.T) {
+		err := db.UpdateRecord(ctx, session, Updates{"UserID": 3})
+		require.NoError(t, err)
+
+		var retrievedSessions []Session
+		err = db.Select(ctx, &retrievedSessions, "ORDER BY token", nil)
+		require.NoError(t, err)
+		require.Len(t, retrievedSessions, 2)
+		require.Equal(t, 3, retrievedSessions[0].UserID)
+		require.Equal(t, 2, retrievedSessions[1].UserID)
+	})
+
+	t.Run("deletes by the primary key column", func(t *testing.T) {
+		n, err := db.DeleteRecord(ctx, session)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+
+		n, err = db.DeleteRecords(ctx, []Session{*other})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+
+		count, err := db.Count(ctx, &Session{}, "", nil)
+		require.NoError(t, err)
+		require.Equal(t, int64(0), count)
+	})
+}
+
+func TestCompositePrimaryKey(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := setupDB(t)
+	db := New(sqlDB)
+
+	memberships := []*TeamMembership{
+		{TeamID: 1, UserID: 1, Role: "owner"},
+		{TeamID: 1, UserID: 2, Role: "member"},
+		{TeamID: 2, UserID: 1, Role: "member"},
+		{TeamID: 2, UserID: 2, Role: "member"},
+	}
+	err := db.InsertRecords(ctx, memberships)
+	require.NoError(t, err)
+
+	t.Run("updates by all primary key columns", func(t *testing.T) {
+		err := db.UpdateRecord(ctx, memberships[1], Updates{"Role": "admin"})
+		require.NoError(t, err)
+
+		var roles []TeamMembership
+		err = db.Select(ctx, &roles, "WHERE role = $role", Args{"role": "admin"})
+		require.NoError(t, err)
+		require.Equal(t, []TeamMembership{{TeamID: 1, UserID: 2, Role: "admin"}}, roles)
+	})
+
+	t.Run("deletes a single record by all primary key columns", func(t *testing.T) {
+		n, err := db.DeleteRecord(ctx, memberships[0])
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+	})
+
+	t.Run("deletes multiple records by all primary key columns", func(t *testing.T) {
+		n, err := db.DeleteRecords(ctx, memberships[1:3])
+		require.NoError(t, err)
+		require.Equal(t, int64(2), n)
+
+		var remaining []TeamMembership
+		err = db.Select(ctx, &remaining, "", nil)
+		require.NoError(t, err)
+		require.Equal(t, []TeamMembership{{TeamID: 2, UserID: 2, Role: "member"}}, remaining)
+	})
+}
+
+func TestTable(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := setupDB(t)
+	db := New(sqlDB)
+	keyValues := NewTable[KeyValue](db)
+
+	t.Run("finds a record by primary key", func(t *testing.T) {
+		kv, err := Find[KeyValue](ctx, db, 3)
+		require.NoError(t, err)
+		requireKVEqual(t, KeyValue{ID: 3, Key: "config.app.name", Value: "MicroORM"}, kv)
+
+		_, err = keyValues.Find(ctx, 999)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("selects one and all records", func(t *testing.T) {
+		kv, err := One[KeyValue](ctx, db, "WHERE `key` = $key", Args{"key": "config.app.version"})
+		require.NoError(t, err)
+		requireKVEqual(t, KeyValue{ID: 4, Key: "config.app.version", Value: "1.0.0"}, kv)
+
+		kvs, err := keyValues.All(ctx, "WHERE `key` LIKE $pattern ORDER BY `key`", Args{"pattern": "config.database.%"})
+		require.NoError(t, err)
+		requireKVsEqual(t, []KeyValue{
+			{ID: 1, Key: "config.database.host", Value: "localhost"},
+			{ID: 2, Key: "config.database.port", Value: "3306"},
+		}, kvs)
+	})
+
+	t.Run("inserts, updates, and deletes records by value", func(t *testing.T) {
+		record := KeyValue{Key: "table.insert", Value: "original"}
+		inserted, err := keyValues.Insert(ctx, record)
+		require.NoError(t, err)
+		require.NotZero(t, inserted.ID)
+		require.Zero(t, record.ID, "the original value should not be modified")
+
+		updated, err := keyValues.Update(ctx, inserted, Updates{"Value": "updated"})
+		require.NoError(t, err)
+		require.Equal(t, "updated", updated.Value)
+		require.Equal(t, "original", inserted.Value)
+
+		found, err := keyValues.Find(ctx, inserted.ID)
+		require.NoError(t, err)
+		require.Equal(t, "updated", found.Value)
+
+		n, err := keyValues.Delete(ctx, found)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+
+		exists, err := keyValues.Exists(ctx, "WHERE id = $id", Args{"id": inserted.ID})
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("inserts and deletes multiple records by value", func(t *testing.T) {
+		records := []KeyValue{{Key: "table.a", Value: "a"}, {Key: "table.b", Value: "b"}}
+		inserted, err := keyValues.InsertAll(ctx, records)
+		require.NoError(t, err)
+		require.NotZero(t, inserted[0].ID)
+		require.Equal(t, inserted[0].ID+1, inserted[1].ID)
+		require.Zero(t, records[0].ID, "the original slice should not be modified")
+
+		count, err := keyValues.Count(ctx, "WHERE `key` LIKE $pattern", Args{"pattern": "table.%"})
+		require.NoError(t, err)
+		require.Equal(t, int64(2), count)
+
+		n, err := keyValues.DeleteAll(ctx, inserted)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), n)
+	})
+}
+
+func TestHooks(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := setupDB(t)
+	db := New(sqlDB)
+
+	t.Run("runs insert hooks in a transaction", func(t *testing.T) {
+		user := &HookedUser{Name: "Fox", Email: "FOX@EXAMPLE.COM"}
+		err := db.InsertRecord(ctx, user)
+		require.NoError(t, err)
+		require.Equal(t, "fox@example.com", user.Email)
+
+		var kv KeyValue
+		err = db.Select(ctx, &kv, "WHERE `key` = $key", Args{"key": fmt.Sprintf("user.%d.created", user.ID)})
+		require.NoError(t, err)
+		require.Equal(t, "fox@example.com", kv.Value)
+	})
+
+	t.Run("after insert errors roll back the insert", func(t *testing.T) {
+		err := db.InsertRecord(ctx, &HookedUser{Email: "nameless@example.com"})
+		require.ErrorContains(t, err, "name is required")
+
+		exists, err := db.Exists(ctx, &HookedUser{}, "WHERE email = $email", Args{"email": "nameless@example.com"})
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("runs insert hooks for each record", func(t *testing.T) {
+		users := []*HookedUser{{Name: "Dana", Email: "DANA@EXAMPLE.COM"}, {Name: "Sam", Email: "SAM@EXAMPLE.COM"}}
+		err := db.InsertRecords(ctx, users)
+		require.NoError(t, err)
+
+		count, err := db.Count(ctx, &KeyValue{}, "WHERE `key` IN ($keys)", Args{
+			"keys": []string{fmt.Sprintf("user.%d.created", users[0].ID), fmt.Sprintf("user.%d.created", users[1].ID)},
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(2), count)
+	})
+
+	t.Run("before update hooks can modify the updates", func(t *testing.T) {
+		user := &HookedUser{Name: "Alex", Email: "alex@example.com"}
+		require.NoError(t, db.InsertRecord(ctx, user))
+
+		updates := Updates{"Email": "ALEX@EXAMPLE.ORG"}
+		err := db.UpdateRecord(ctx, user, updates)
+		require.NoError(t, err)
+		require.Equal(t, "alex@example.org", user.Email)
+		require.Equal(t, "ALEX@EXAMPLE.ORG", updates["Email"], "the caller's updates should not be modified")
+	})
+
+	t.Run("runs after find hooks", func(t *testing.T) {
+		var user HookedUser
+		err := db.Select(ctx, &user, "WHERE name = $name", Args{"name": "Fox"})
+		require.NoError(t, err)
+		require.Equal(t, "Fox <fox@example.com>", user.Display)
+
+		var users []HookedUser
+		err = db.Select(ctx, &users, "WHERE name IN ($names) ORDER BY name", Args{"names": []string{"Dana", "Sam"}})
+		require.NoError(t, err)
+		require.Len(t, users, 2)
+		require.Equal(t, "Dana <dana@example.com>", users[0].Display)
+		require.Equal(t, "Sam <sam@example.com>", users[1].Display)
+
+		for user, err := range SelectIter[HookedUser](ctx, db, "WHERE name = $name", Args{"name": "Fox"}) {
+			require.NoError(t, err)
+			require.Equal(t, "Fox <fox@example.com>", user.Display)
+		}
+	})
+
+	t.Run("before delete errors abort the delete", func(t *testing.T) {
+		user := &HookedUser{Name: "protected", Email: "protected@example.com"}
+		require.NoError(t, db.InsertRecord(ctx, user))
+
+		_, err := db.DeleteRecord(ctx, user)
+		require.ErrorContains(t, err, "protected users can't be deleted")
+
+		_, err = db.DeleteRecords(ctx, []*HookedUser{user})
+		require.ErrorContains(t, err, "protected users can't be deleted")
+
+		exists, err := db.Exists(ctx, &HookedUser{}, "WHERE id = $id", Args{"id": user.ID})
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+}
+
+func TestValidation(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := setupDB(t)
+	db := New(sqlDB)
+
+	t.Run("invalid records are not inserted", func(t *testing.T) {
+		err := db.InsertRecord(ctx, &ValidatedUser{Name: "Walter Skinner"})
+
+		var validationErrs ValidationErrors
+		require.ErrorAs(t, err, &validationErrs)
+		require.Equal(t, ValidationErrors{
+			{Field: "Name", Column: "name", Rule: "max", Message: "must be at most 10 characters"},
+			{Field: "Email", Column: "email", Rule: "required", Message: "is required"},
+		}, validationErrs)
+
+		exists, err := db.Exists(ctx, &ValidatedUser{}, "WHERE name = $name", Args{"name": "Walter Skinner"})
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("no records are inserted when one is invalid", func(t *testing.T) {
+		err := db.InsertRecords(ctx, []ValidatedUser{
+			{Name: "Skinner", Email: "skinner@fbi.gov"},
+			{Name: "Krycek"},
+		})
+		require.ErrorContains(t, err, "invalid record at index 1")
+		require.ErrorAs(t, err, &ValidationErrors{})
+
+		exists, err := db.Exists(ctx, &ValidatedUser{}, "WHERE name = $name", Args{"name": "Skinner"})
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("validates records with the updates applied", func(t *testing.T) {
+		user := &ValidatedUser{Name: "Skinner", Email: "skinner@fbi.gov"}
+		require.NoError(t, db.InsertRecord(ctx, user))
+
+		err := db.UpdateRecord(ctx, user, Updates{"Name": ""})
+		require.ErrorAs(t, err, &ValidationErrors{})
+		require.Equal(t, "Skinner", user.Name)
+
+		var found ValidatedUser
+		require.NoError(t, db.Select(ctx, &found, "WHERE id = $id", Args{"id": user.ID}))
+		require.Equal(t, "Skinner", found.Name)
+
+		err = db.UpdateRecord(ctx, user, Updates{"Name": "Walter"})
+		require.NoError(t, err)
+		require.Equal(t, "Walter", user.Name)
+	})
+
+	t.Run("validates records after before hooks", func(t *testing.T) {
+		user := &NormalizedUser{Email: "mulder@fbi.gov"}
+		require.NoError(t, db.InsertRecord(ctx, user))
+		require.Equal(t, "mulder", user.Name)
+
+		users := []*NormalizedUser{{Email: "scully@fbi.gov"}}
+		require.NoError(t, db.InsertRecords(ctx, users))
+		require.Equal(t, "scully", users[0].Name)
+
+		err := db.UpdateRecord(ctx, user, Updates{"Email": "fox.william.mulder@fbi.gov"})
+		var validationErrs ValidationErrors
+		require.ErrorAs(t, err, &validationErrs)
+		require.Equal(t, "name", validationErrs[0].Column)
+		require.Equal(t, "mulder@fbi.gov", user.Email)
+
+		require.NoError(t, db.UpdateRecord(ctx, user, Updates{"Email": "fox@fbi.gov"}))
+		require.Equal(t, "fox", user.Name)
+	})
+}
+
+func TestTransaction(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := setupDB(t)
+	db := New(sqlDB)
+
+	t.Run("successful transaction commits changes", func(t *testing.T) {
+		var insertedKV *KeyValue
+
+		err := db.Transaction(ctx, func(tx *DB) error {
+			kv := &KeyValue{
+				Key:   "test.transaction.commit",
+				Value: "transaction commit test",
+			}
+
+			err := tx.InsertRecord(ctx, kv)
+			if err != nil {
+				return err
+			}
+
+			insertedKV = kv
+			return nil
+		})
+
+		require.NoError(t, err)
+		require.NotNil(t, insertedKV)
+		require.NotEqual(t, 0, insertedKV.ID)
+
+		var retrievedKV KeyValue
+		err = db.Select(ctx, &retrievedKV, "WHERE `key` = $key", Args{
+			"key": "test.transaction.commit",
+		})
+		require.NoError(t, err)
+		require.Equal(t, insertedKV.ID, retrievedKV.ID)
+		require.Equal(t, "test.transaction.commit", retrievedKV.Key)
+		require.Equal(t, "transaction commit test", retrievedKV.Value)
+	})
+
+	t.Run("failed transaction rolls back changes", func(t *testing.T) {
+		var insertedKV *KeyValue
+
+		err := db.Transaction(ctx, func(tx *DB) error {
+			kv := &KeyValue{
+				Key:   "test.transaction.rollback",
+				Value: "transaction rollback test",
+			}
+
+			err := tx.InsertRecord(ctx, kv)
+			if err != nil {
+				return err
+			}
+
+			insertedKV = kv
+
+			return fmt.Errorf("intentional error to trigger rollback")
+		})
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "intentional error to trigger rollback")
+		require.NotNil(t, insertedKV)
+		require.NotEqual(t, 0, insertedKV.ID)
+
+		var retrievedKV KeyValue
+		err = db.Select(ctx, &retrievedKV, "WHERE `key` = $key", Args{
+			"key": "test.transaction.rollback",
+		})
+		require.Error(t, err)
+		require.Equal(t, sql.ErrNoRows, err)
+	})
+
+	t.Run("multiple operations in transaction", func(t *testing.T) {
+		var kv1, kv2 *KeyValue
+
+		err := db.Transaction(ctx, func(tx *DB) error {
+			kv1 = &KeyValue{
+				Key:   "test.transaction.multi.1",
+				Value: "first record",
+			}
+			err := tx.InsertRecord(ctx, kv1)
+			if err != nil {
+				return err
+			}
+
+			kv2 = &KeyValue{
+				Key:   "test.transaction.multi.2",
+				Value: "second record",
+			}
+			err = tx.InsertRecord(ctx, kv2)
+			if err != nil {
+				return err
+			}
+
+			var kvs []KeyValue
+			err = tx.Select(ctx, &kvs, "WHERE `key` LIKE $pattern ORDER BY `key`", Args{
+				"pattern": "test.transaction.multi.%",
+			})
+			if err != nil {
+				return err
+			}
+
+			if len(kvs) != 2 {
+				return fmt.Errorf("expected 2 records in transaction, got %d", len(kvs))
+			}
+
+			return nil
+		})
+
+		require.NoError(t, err)
+		require.NotNil(t, kv1)
+		require.NotNil(t, kv2)
+		require.NotEqual(t, 0, kv1.ID)
+		require.NotEqual(t, 0, kv2.ID)
+		require.NotEqual(t, kv1.ID, kv2.ID)
+
+		var kvs []KeyValue
+		err = db.Select(ctx, &kvs, "WHERE `key` LIKE $pattern ORDER BY `key`", Args{
+			"pattern": "test.transaction.multi.%",
+		})
+		require.NoError(t, err)
+		require.Len(t, kvs, 2)
+		require.Equal(t, "test.transaction.multi.1", kvs[0].Key)
+		require.Equal(t, "test.transaction.multi.2", kvs[1].Key)
+	})
+
+	t.Run("transaction rollback with multiple operations", func(t *testing.T) {
+		var kv1, kv2 *KeyValue
+
+		err := db.Transaction(ctx, func(tx *DB) error {
+			kv1 = &KeyValue{
+				Key:   "test.transaction.rollback.multi.1",
+				Value: "first record",
+			}
+			err := tx.InsertRecord(ctx, kv1)
+			if err != nil {
+				return err
+			}
+
+			kv2 = &KeyValue{
+				Key:   "test.transaction.rollback.multi.2",
+				Value: "second record",
+			}
+			err = tx.InsertRecord(ctx, kv2)
+			if err != nil {
+				return err
+			}
+
+			return fmt.Errorf("rollback both operations")
+		})
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "rollback both operations")
+
+		var kvs []KeyValue
+		err = db.Select(ctx, &kvs, "WHERE `key` LIKE $pattern", Args{
+			"pattern": "test.transaction.rollback.multi.%",
+		})
+		require.NoError(t, err)
+		require.Len(t, kvs, 0, "No records should be committed after rollback")
+	})
+
+	t.Run("transaction with panic triggers rollback", func(t *testing.T) {
+		var insertedKV *KeyValue
+
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					require.Equal(t, "panic in transaction", r)
+				}
+			}()
+
+			_ = db.Transaction(ctx, func(tx *DB) error {
+				kv := &KeyValue{
+					Key:   "test.transaction.panic",
+					Value: "panic test",
+				}
+
+				err := tx.InsertRecord(ctx, kv)
+				if err != nil {
+					return err
+				}
+
+				insertedKV = kv
+
+				panic("panic in transaction")
+			})
+
+			t.Fatal("Expected panic but transaction completed normally")
+		}()
+
+		require.NotNil(t, insertedKV)
+
+		var retrievedKV KeyValue
+		err := db.Select(ctx, &retrievedKV, "WHERE `key` = $key", Args{
+			"key": "test.transaction.panic",
+		})
+		require.Error(t, err)
+		require.Equal(t, sql.ErrNoRows, err)
+	})
+
+	t.Run("nested transaction commits with outer transaction", func(t *testing.T) {
+		err := db.Transaction(ctx, func(tx *DB) error {
+			return tx.Transaction(ctx, func(nestedTx *DB) error {
+				return nestedTx.InsertRecord(ctx, &KeyValue{Key: "test.nested.commit", Value: "nested"})
+			})
+		})
+		require.NoError(t, err)
+
+		exists, err := db.Exists(ctx, &KeyValue{}, "WHERE `key` = $key", Args{"key": "test.nested.commit"})
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+
+	t.Run("failed nested transaction rolls back to savepoint", func(t *testing.T) {
+		err := db.Transaction(ctx, func(tx *DB) error {
+			if err := tx.InsertRecord(ctx, &KeyValue{Key: "test.nested.outer", Value: "outer"}); err != nil {
+				return err
+			}
+
+			nestedErr := tx.Transaction(ctx, func(nestedTx *DB) error {
+				if err := nestedTx.InsertRecord(ctx, &KeyValue{Key: "test.nested.inner", Value: "inner"}); err != nil {
+					return err
+				}
+				return fmt.Errorf("nested failure")
+			})
+			require.EqualError(t, nestedErr, "nested failure")
+
+			// Savepoint names are unique, so a sibling savepoint can follow
+			return tx.Transaction(ctx, func(nestedTx *DB) error {
+				return nestedTx.InsertRecord(ctx, &KeyValue{Key: "test.nested.sibling", Value: "sibling"})
+			})
+		})
+		require.NoError(t, err)
+
+		var kvs []KeyValue
+		err = db.Select(ctx, &kvs, "WHERE `key` LIKE $pattern ORDER BY `key`", Args{"pattern": "test.nested.%"})
+		require.NoError(t, err)
+
+		keys := make([]string, 0, len(kvs))
+		for _, kv := range kvs {
+			keys = append(keys, kv.Key)
+		}
+		require.Equal(t, []string{"test.nested.commit", "test.nested.outer", "test.nested.sibling"}, keys)
+	})
+
+	t.Run("failed outer transaction rolls back nested transactions", func(t *testing.T) {
+		err := db.Transaction(ctx, func(tx *DB) error {
+			err := tx.Transaction(ctx, func(nestedTx *DB) error {
+				return nestedTx.InsertRecord(ctx, &KeyValue{Key: "test.nested.discarded", Value: "discarded"})
+			})
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("outer failure")
+		})
+		require.EqualError(t, err, "outer failure")
+
+		exists, err := db.Exists(ctx, &KeyValue{}, "WHERE `key` = $key", Args{"key": "test.nested.discarded"})
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("record methods using transactions can be called within a transaction", func(t *testing.T) {
+		err := db.Transaction(ctx, func(tx *DB) error {
+			return tx.InsertRecords(ctx, []*KeyValue{{Key: "test.nested.records", Value: "records"}})
+		})
+		require.NoError(t, err)
+	})
+}
+
+func TestTransactionCallbacks(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := setupDB(t)
+	db := New(sqlDB)
+
+	t.Run("calls after commit callbacks in order once committed", func(t *testing.T) {
+		var calls []string
+		err := db.Transaction(ctx, func(tx *DB) error {
+			tx.AfterCommit(func(ctx context.Context) {
+				// The transaction's writes are visible once committed
+				exists, err := db.Exists(ctx, &KeyValue{}, "WHERE `key` = $key", Args{"key": "test.callbacks.commit"})
+				require.NoError(t, err)
+				require.True(t, exists)
+				calls = append(calls, "first")
+			})
+			tx.AfterCommit(func(context.Context) { calls = append(calls, "second") })
+			tx.AfterRollback(func(context.Context, error) { calls = append(calls, "rollback") })
+
+			err := tx.InsertRecord(ctx, &KeyValue{Key: "test.callbacks.commit", Value: "commit"})
+			require.Empty(t, calls, "callbacks must not be called before commit")
+			return err
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, []string{"first", "second"}, calls)
+	})
+
+	t.Run("calls after rollback callbacks with the error", func(t *testing.T) {
+		var calls []string
+		var rollbackErr error
+		err := db.Transaction(ctx, func(tx *DB) error {
+			tx.AfterCommit(func(context.Context) { calls = append(calls, "commit") })
+			tx.AfterRollback(func(_ context.Context, err error) {
+				calls = append(calls, "rollback")
+				rollbackErr = err
+			})
+			return fmt.Errorf("rollback please")
+		})
+
+		require.EqualError(t, err, "rollback please")
+		require.Equal(t, []string{"rollback"}, calls)
+		require.Equal(t, err, rollbackErr)
+	})
+
+	t.Run("promotes nested callbacks to the outer transaction", func(t *testing.T) {
+		var calls []string
+		err := db.Transaction(ctx, func(tx *DB) error {
+			tx.AfterCommit(func(context.Context) { calls = append(calls, "outer") })
+
+			err := tx.Transaction(ctx, func(nestedTx *DB) error {
+				nestedTx.AfterCommit(func(context.Context) { calls = append(calls, "released") })
+				return nil
+			})
+			require.NoError(t, err)
+			require.Empty(t, calls, "nested callbacks must wait for the outer commit")
+
+			_ = tx.Transaction(ctx, func(nestedTx *DB) error {
+				nestedTx.AfterCommit(func(context.Context) { calls = append(calls, "discarded") })
+				nestedTx.AfterRollback(func(context.Context, error) { calls = append(calls, "rolled back") })
+				return fmt.Errorf("nested failure")
+			})
+			require.Equal(t, []string{"rolled back"}, calls)
+
+			return nil
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, []string{"rolled back", "outer", "released"}, calls)
+	})
+
+	t.Run("calls promoted rollback callbacks when the outer transaction rolls back", func(t *testing.T) {
+		var calls []string
+		err := db.Transaction(ctx, func(tx *DB) error {
+			err := tx.Transaction(ctx, func(nestedTx *DB) error {
+				nestedTx.AfterCommit(func(context.Context) { calls = append(calls, "commit") })
+				nestedTx.AfterRollback(func(context.Context, error) { calls = append(calls, "rollback") })
+				return nil
+			})
+			require.NoError(t, err)
+
+			return fmt.Errorf("outer failure")
+		})
+
+		require.EqualError(t, err, "outer failure")
+		require.Equal(t, []string{"rollback"}, calls)
+	})
+}
+
+func TestContextTransaction(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := setupDB(t)
+	db := New(sqlDB)
+
+	// createKeyValue only has access to the root DB, like a repository
+	createKeyValue := func(ctx context.Context, key string) error {
+		return db.InsertRecord(ctx, &KeyValue{Key: key, Value: "context"})
+	}
+
+	t.Run("root DB joins the transaction in the context", func(t *testing.T) {
+		err := db.Transaction(ctx, func(tx *DB) error {
+			ctx := WithTx(ctx, tx)
+			if err := createKeyValue(ctx, "test.context.rollback"); err != nil {
+				return err
+			}
+
+			exists, err := db.Exists(ctx, &KeyValue{}, "WHERE `key` = $key", Args{"key": "test.context.rollback"})
+			require.NoError(t, err)
+			require.True(t, exists, "the write should be visible within the transaction")
+
+			return fmt.Errorf("rollback")
+		})
+		require.EqualError(t, err, "rollback")
+
+		exists, err := db.Exists(ctx, &KeyValue{}, "WHERE `key` = $key", Args{"key": "test.context.rollback"})
+		require.NoError(t, err)
+		require.False(t, exists, "the write should be rolled back with the transaction")
+	})
+
+	t.Run("root DB transactions are nested in the transaction in the context", func(t *testing.T) {
+		err := db.Transaction(ctx, func(tx *DB) error {
+			ctx := WithTx(ctx, tx)
+
+			_ = db.Transaction(ctx, func(nestedTx *DB) error {
+				if err := createKeyValue(ctx, "test.context.nested"); err != nil {
+					return err
+				}
+				return fmt.Errorf("nested failure")
+			})
+
+			return createKeyValue(ctx, "test.context.commit")
+		})
+		require.NoError(t, err)
+
+		var kvs []KeyValue
+		err = db.Select(ctx, &kvs, "WHERE `key` LIKE $pattern", Args{"pattern": "test.context.%"})
+		require.NoError(t, err)
+		require.Len(t, kvs, 1)
+		require.Equal(t, "test.context.commit", kvs[0].Key)
+	})
+}
+
+func TestNewFromConn(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := setupDB(t)
 
-		db := &DB{
-			db:             db.db,
-			modelTypeCache: db.modelTypeCache,
-			Pluralizer:     db.Pluralizer,
-			time:           mockClock,
-		}
+	conn, err := sqlDB.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
 
-		kv := &KeyValue{
-			Key:   "test.insert.createdat",
-			Value: "test created at",
-		}
+	db := NewFromConn(conn)
 
-		require.True(t, kv.CreatedAt.IsZero(), "CreatedAt should be zero before insert")
+	t.Run("uses a single connection", func(t *testing.T) {
+		_, err := db.Exec(ctx, "SET @dbmap_session = $value", Args{"value": "pinned"})
+		require.NoError(t, err)
 
-		err := db.InsertRecord(ctx, kv)
+		rows, err := db.Query(ctx, "SELECT @dbmap_session", nil)
 		require.NoError(t, err)
+		defer rows.Close()
 
-		require.False(t, kv.CreatedAt.IsZero(), "CreatedAt should not be zero after insert")
-		require.Equal(t, insertTime, kv.CreatedAt, "CreatedAt should match the mock time")
-		require.Equal(t, insertTime, kv.UpdatedAt, "UpdatedAt should match the mock time")
+		var value string
+		require.True(t, rows.Next())
+		require.NoError(t, rows.Scan(&value))
+		require.Equal(t, "pinned", value)
+	})
 
-		var retrievedKV KeyValue
-		err = db.Select(ctx, &retrievedKV, "WHERE `key` = $key", Args{"key": "test.insert.createdat"})
+	t.Run("begins transactions on the connection", func(t *testing.T) {
+		err := db.Transaction(ctx, func(tx *DB) error {
+			return tx.InsertRecord(ctx, &KeyValue{Key: "test.conn.transaction", Value: "conn"})
+		})
 		require.NoError(t, err)
-		require.WithinDuration(t, kv.CreatedAt, retrievedKV.CreatedAt, time.Second, "CreatedAt should match between struct and database within 1 second")
+
+		exists, err := db.Exists(ctx, &KeyValue{}, "WHERE `key` = $key", Args{"key": "test.conn.transaction"})
+		require.NoError(t, err)
+		require.True(t, exists)
 	})
 }
 
-func TestTransaction(t *testing.T) {
+func TestNewFromTx(t *testing.T) {
 	ctx := context.Background()
 	sqlDB := setupDB(t)
-	db := New(sqlDB)
 
-	t.Run("successful transaction commits changes", func(t *testing.T) {
-		var insertedKV *KeyValue
+	t.Run("executes within the transaction", func(t *testing.T) {
+		tx, err := sqlDB.BeginTx(ctx, nil)
+		require.NoError(t, err)
 
-		err := db.Transaction(ctx, func(tx *DB) error {
-			kv := &KeyValue{
-				Key:   "test.transaction.commit",
-				Value: "transaction commit test",
-			}
+		db := NewFromTx(tx)
+		err = db.InsertRecord(ctx, &KeyValue{Key: "test.tx.rollback", Value: "tx"})
+		require.NoError(t, err)
+		require.NoError(t, tx.Rollback())
 
-			err := tx.InsertRecord(ctx, kv)
-			if err != nil {
+		exists, err := New(sqlDB).Exists(ctx, &KeyValue{}, "WHERE `key` = $key", Args{"key": "test.tx.rollback"})
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("creates savepoints for transactions", func(t *testing.T) {
+		tx, err := sqlDB.BeginTx(ctx, nil)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		db := NewFromTx(tx)
+		err = db.Transaction(ctx, func(nestedTx *DB) error {
+			if err := nestedTx.InsertRecord(ctx, &KeyValue{Key: "test.tx.savepoint", Value: "tx"}); err != nil {
 				return err
 			}
-
-			insertedKV = kv
-			return nil
+			return fmt.Errorf("nested failure")
 		})
+		require.EqualError(t, err, "nested failure")
 
+		exists, err := db.Exists(ctx, &KeyValue{}, "WHERE `key` = $key", Args{"key": "test.tx.savepoint"})
 		require.NoError(t, err)
-		require.NotNil(t, insertedKV)
-		require.NotEqual(t, 0, insertedKV.ID)
+		require.False(t, exists)
 
-		var retrievedKV KeyValue
-		err = db.Select(ctx, &retrievedKV, "WHERE `key` = $key", Args{
-			"key": "test.transaction.commit",
-		})
-		require.NoError(t, err)
-		require.Equal(t, insertedKV.ID, retrievedKV.ID)
-		require.Equal(t, "test.transaction.commit", retrievedKV.Key)
-		require.Equal(t, "transaction commit test", retrievedKV.Value)
+		err = db.AfterCommit(func(context.Context) {})
+		require.ErrorIs(t, err, ErrExternalTransaction, "callbacks can't be called for transactions owned by the caller")
 	})
+}
 
-	t.Run("failed transaction rolls back changes", func(t *testing.T) {
-		var insertedKV *KeyValue
-
-		err := db.Transaction(ctx, func(tx *DB) error {
-			kv := &KeyValue{
-				Key:   "test.transaction.rollback",
-				Value: "transaction rollback test",
-			}
+func TestTransactionWithOptions(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := setupDB(t)
+	db := New(sqlDB)
 
-			err := tx.InsertRecord(ctx, kv)
+	t.Run("uses the isolation level", func(t *testing.T) {
+		err := db.TransactionWithOptions(ctx, TxOptions{Isolation: sql.LevelSerializable}, func(tx *DB) error {
+			rows, err := tx.Query(ctx, "SELECT @@transaction_isolation", nil)
 			if err != nil {
 				return err
 			}
+			defer rows.Close()
 
-			insertedKV = kv
-
-			return fmt.Errorf("intentional error to trigger rollback")
+			var isolation string
+			require.True(t, rows.Next())
+			require.NoError(t, rows.Scan(&isolation))
+			require.Equal(t, "SERIALIZABLE", isolation)
+			return rows.Err()
 		})
+		require.NoError(t, err)
+	})
 
-		require.Error(t, err)
-		require.Contains(t, err.Error(), "intentional error to trigger rollback")
-		require.NotNil(t, insertedKV)
-		require.NotEqual(t, 0, insertedKV.ID)
-
-		var retrievedKV KeyValue
-		err = db.Select(ctx, &retrievedKV, "WHERE `key` = $key", Args{
-			"key": "test.transaction.rollback",
+	t.Run("read-only transactions can not write", func(t *testing.T) {
+		err := db.TransactionWithOptions(ctx, TxOptions{ReadOnly: true}, func(tx *DB) error {
+			return tx.InsertRecord(ctx, &KeyValue{Key: "test.readonly", Value: "readonly"})
 		})
 		require.Error(t, err)
-		require.Equal(t, sql.ErrNoRows, err)
-	})
-
-	t.Run("multiple operations in transaction", func(t *testing.T) {
-		var kv1, kv2 *KeyValue
 
-		err := db.Transaction(ctx, func(tx *DB) error {
-			kv1 = &KeyValue{
-				Key:   "test.transaction.multi.1",
-				Value: "first record",
-			}
-			err := tx.InsertRecord(ctx, kv1)
-			if err != nil {
-				return err
-			}
-
-			kv2 = &KeyValue{
-				Key:   "test.transaction.multi.2",
-				Value: "second record",
-			}
-			err = tx.InsertRecord(ctx, kv2)
-			if err != nil {
-				return err
-			}
+		exists, err := db.Exists(ctx, &KeyValue{}, "WHERE `key` = $key", Args{"key": "test.readonly"})
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
 
-			var kvs []KeyValue
-			err = tx.Select(ctx, &kvs, "WHERE `key` LIKE $pattern ORDER BY `key`", Args{
-				"pattern": "test.transaction.multi.%",
-			})
-			if err != nil {
+	t.Run("retries deadlocks with a new transaction", func(t *testing.T) {
+		var txs []*DB
+		err := db.TransactionWithOptions(ctx, TxOptions{Retry: &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}}, func(tx *DB) error {
+			txs = append(txs, tx)
+			if err := tx.InsertRecord(ctx, &KeyValue{Key: "test.retry", Value: "retry"}); err != nil {
 				return err
 			}
 
-			if len(kvs) != 2 {
-				return fmt.Errorf("expected 2 records in transaction, got %d", len(kvs))
+			if len(txs) == 1 {
+				return fmt.Errorf("failed to update: %w", &mysql.MySQLError{Number: 1213, Message: "Deadlock found"})
 			}
-
 			return nil
 		})
+		require.NoError(t, err)
+		require.Len(t, txs, 2)
+		require.NotSame(t, txs[0], txs[1])
 
+		count, err := db.Count(ctx, &KeyValue{}, "WHERE `key` = $key", Args{"key": "test.retry"})
 		require.NoError(t, err)
-		require.NotNil(t, kv1)
-		require.NotNil(t, kv2)
-		require.NotEqual(t, 0, kv1.ID)
-		require.NotEqual(t, 0, kv2.ID)
-		require.NotEqual(t, kv1.ID, kv2.ID)
+		require.Equal(t, int64(1), count, "the first attempt should be rolled back")
+	})
 
-		var kvs []KeyValue
-		err = db.Select(ctx, &kvs, "WHERE `key` LIKE $pattern ORDER BY `key`", Args{
-			"pattern": "test.transaction.multi.%",
+	t.Run("stops retrying after max attempts", func(t *testing.T) {
+		attempts := 0
+		err := db.TransactionWithOptions(ctx, TxOptions{Retry: &RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}}, func(tx *DB) error {
+			attempts++
+			return &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}
 		})
-		require.NoError(t, err)
-		require.Len(t, kvs, 2)
-		require.Equal(t, "test.transaction.multi.1", kvs[0].Key)
-		require.Equal(t, "test.transaction.multi.2", kvs[1].Key)
+
+		var mysqlErr *mysql.MySQLError
+		require.ErrorAs(t, err, &mysqlErr)
+		require.Equal(t, 2, attempts)
 	})
 
-	t.Run("transaction rollback with multiple operations", func(t *testing.T) {
-		var kv1, kv2 *KeyValue
+	t.Run("does not retry other errors", func(t *testing.T) {
+		attempts := 0
+		err := db.TransactionWithOptions(ctx, TxOptions{Retry: &RetryPolicy{}}, func(tx *DB) error {
+			attempts++
+			return fmt.Errorf("not retryable")
+		})
 
-		err := db.Transaction(ctx, func(tx *DB) error {
-			kv1 = &KeyValue{
-				Key:   "test.transaction.rollback.multi.1",
-				Value: "first record",
-			}
-			err := tx.InsertRecord(ctx, kv1)
-			if err != nil {
-				return err
-			}
+		require.EqualError(t, err, "not retryable")
+		require.Equal(t, 1, attempts)
+	})
+}
 
-			kv2 = &KeyValue{
-				Key:   "test.transaction.rollback.multi.2",
-				Value: "second record",
-			}
-			err = tx.InsertRecord(ctx, kv2)
-			if err != nil {
-				return err
-			}
+func TestInterceptors(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := setupDB(t)
+	db := New(sqlDB)
 
-			return fmt.Errorf("rollback both operations")
-		})
+	var statements []Statement
+	var results []Result
+	db.Interceptors = []Interceptor{
+		func(ctx context.Context, stmt *Statement, next Handler) (Result, error) {
+			result, err := next(ctx, stmt)
+			statements = append(statements, *stmt)
+			results = append(results, result)
 
-		require.Error(t, err)
-		require.Contains(t, err.Error(), "rollback both operations")
+			return result, err
+		},
+	}
 
-		var kvs []KeyValue
-		err = db.Select(ctx, &kvs, "WHERE `key` LIKE $pattern", Args{
-			"pattern": "test.transaction.rollback.multi.%",
-		})
-		require.NoError(t, err)
-		require.Len(t, kvs, 0, "No records should be committed after rollback")
+	t.Run("observes statements and results", func(t *testing.T) {
+		statements, results = nil, nil
+
+		require.NoError(t, db.InsertRecord(ctx, &KeyValue{Key: "intercepted", Value: "a"}))
+
+		var found []KeyValue
+		require.NoError(t, db.Select(ctx, &found, "WHERE `key` = $key", Args{"key": "intercepted"}))
+
+		require.Len(t, statements, 2)
+		require.Equal(t, OpInsert, statements[0].Operation)
+		require.Equal(t, "key_values", statements[0].Table)
+		require.Equal(t, int64(1), results[0].RowsAffected)
+		require.NotZero(t, results[0].LastInsertID)
+
+		require.Equal(t, OpSelect, statements[1].Operation)
+		require.Equal(t, "WHERE `key` = $key", statements[1].Fragment)
+		require.Equal(t, []any{"intercepted"}, statements[1].Args)
+		require.Equal(t, Result{RowsReturned: 1}, results[1])
 	})
 
-	t.Run("transaction with panic triggers rollback", func(t *testing.T) {
-		var insertedKV *KeyValue
+	t.Run("selects without a matching row aren't failures", func(t *testing.T) {
+		var buf bytes.Buffer
+		var metrics MetricsCollector
+		db := New(sqlDB)
+		db.Interceptors = []Interceptor{
+			func(ctx context.Context, stmt *Statement, next Handler) (Result, error) {
+				result, err := next(ctx, stmt)
+				require.NoError(t, err)
+				return result, err
+			},
+		}
+		db.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		db.Metrics = &metrics
 
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					require.Equal(t, "panic in transaction", r)
-				}
-			}()
+		var kv KeyValue
+		err := db.Select(ctx, &kv, "WHERE `key` = $key", Args{"key": "missing"})
+		require.ErrorIs(t, err, ErrNotFound)
 
-			_ = db.Transaction(ctx, func(tx *DB) error {
-				kv := &KeyValue{
-					Key:   "test.transaction.panic",
-					Value: "panic test",
-				}
+		require.Contains(t, buf.String(), `"level":"DEBUG","msg":"executed statement"`)
+		require.NotContains(t, buf.String(), "statement failed")
 
-				err := tx.InsertRecord(ctx, kv)
-				if err != nil {
-					return err
+		stats := metrics.Snapshot()
+		require.Len(t, stats, 1)
+		require.Equal(t, int64(1), stats[0].Count)
+		require.Zero(t, stats[0].Errors)
+	})
+
+	t.Run("short-circuits statements", func(t *testing.T) {
+		db := New(sqlDB)
+		db.Interceptors = []Interceptor{
+			func(ctx context.Context, stmt *Statement, next Handler) (Result, error) {
+				if stmt.Operation == OpDelete {
+					return Result{}, errors.New("deletes are disabled")
 				}
 
-				insertedKV = kv
+				return next(ctx, stmt)
+			},
+		}
 
-				panic("panic in transaction")
-			})
+		_, err := db.Delete(ctx, &KeyValue{}, "WHERE `key` = $key", Args{"key": "intercepted"})
+		require.EqualError(t, err, "failed to execute delete: deletes are disabled")
 
-			t.Fatal("Expected panic but transaction completed normally")
-		}()
+		exists, err := db.Exists(ctx, &KeyValue{}, "WHERE `key` = $key", Args{"key": "intercepted"})
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+}
 
-		require.NotNil(t, insertedKV)
+func TestTracer(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := setupDB(t)
+	db := New(sqlDB)
+	tracer := &MemoryTracer{}
+	db.Tracer = tracer
 
-		var retrievedKV KeyValue
-		err := db.Select(ctx, &retrievedKV, "WHERE `key` = $key", Args{
-			"key": "test.transaction.panic",
+	err := db.Transaction(ctx, func(tx *DB) error {
+		if err := tx.InsertRecord(ctx, &KeyValue{Key: "traced", Value: "a"}); err != nil {
+			return err
+		}
+
+		return tx.Transaction(ctx, func(tx *DB) error {
+			_, err := tx.Count(ctx, &KeyValue{}, "WHERE `key` = $key", Args{"key": "traced"})
+			return err
 		})
-		require.Error(t, err)
-		require.Equal(t, sql.ErrNoRows, err)
 	})
+	require.NoError(t, err)
 
-	t.Run("nested transactions not supported", func(t *testing.T) {
-		err := db.Transaction(ctx, func(tx *DB) error {
-			return tx.Transaction(ctx, func(nestedTx *DB) error {
-				return nil
-			})
-		})
+	spans := tracer.Spans()
+	require.Len(t, spans, 4)
 
-		require.Error(t, err)
-	})
+	transaction, insert, savepoint, count := spans[0], spans[1], spans[2], spans[3]
+	require.Equal(t, OpTransaction, transaction.Operation)
+	require.Nil(t, transaction.Parent)
+
+	require.Equal(t, OpInsert, insert.Operation)
+	require.Same(t, transaction, insert.Parent)
+	require.Equal(t, "mysql", insert.Attributes[AttrDBSystem])
+	require.Equal(t, "key_values", insert.Attributes[AttrTable])
+	require.Equal(t, int64(1), insert.Attributes[AttrRowsAffected])
+
+	require.Equal(t, OpTransaction, savepoint.Operation)
+	require.Same(t, transaction, savepoint.Parent)
+	require.Equal(t, true, savepoint.Attributes[AttrNested])
+
+	require.Equal(t, OpSelect, count.Operation)
+	require.Same(t, savepoint, count.Parent)
+	require.Equal(t, int64(1), count.Attributes[AttrRowsReturned])
+
+	for _, span := range spans {
+		require.True(t, span.Ended)
+		require.NoError(t, span.Err)
+	}
 }
 
 func TestDelete(t *testing.T) {
@@ -1367,15 +2545,60 @@ func TestExec(t *testing.T) {
 		_, err = db.Exec(ctx, "DELETE FROM key_values WHERE `key` = 'test.dollar'", map[string]any{})
 		require.NoError(t, err)
 	})
+
+	t.Run("exec with struct parameters", func(t *testing.T) {
+		kv := &KeyValue{Key: "test.struct.params", Value: "before"}
+		err := db.InsertRecord(ctx, kv)
+		require.NoError(t, err)
+
+		kv.Value = "after"
+		result, err := db.Exec(ctx, "UPDATE key_values SET value = $Value WHERE id = $id", kv)
+		require.NoError(t, err)
+
+		rowsAffected, err := result.RowsAffected()
+		require.NoError(t, err)
+		require.Equal(t, int64(1), rowsAffected)
+
+		var retrievedKV KeyValue
+		err = db.Select(ctx, &retrievedKV, "WHERE `key` = $key", kv)
+		require.NoError(t, err)
+		require.Equal(t, "after", retrievedKV.Value)
+	})
 }
 
 func setupTestTables(db *sql.DB) error {
 	// Drop existing tables
-	dropSQL := `DROP TABLE IF EXISTS key_values, users;`
+	dropSQL := `DROP TABLE IF EXISTS key_values, users, sessions, team_memberships;`
 	if _, err := db.Exec(dropSQL); err != nil {
 		return fmt.Errorf("failed to drop existing tables: %w", err)
 	}
 
+	// Create sessions table for custom primary key tests
+	createSessionsSQL := `
+		CREATE TABLE sessions (
+			token VARCHAR(64) PRIMARY KEY,
+			user_id INT NOT NULL,
+			created_at TIMESTAMP NULL,
+			updated_at TIMESTAMP NULL
+		)
+	`
+	if _, err := db.Exec(createSessionsSQL); err != nil {
+		return fmt.Errorf("failed to create sessions table: %w", err)
+	}
+
+	// Create team_memberships table for composite primary key tests
+	createTeamMembershipsSQL := `
+		CREATE TABLE team_memberships (
+			team_id INT NOT NULL,
+			user_id INT NOT NULL,
+			role VARCHAR(255) NOT NULL,
+			PRIMARY KEY (team_id, user_id)
+		)
+	`
+	if _, err := db.Exec(createTeamMembershipsSQL); err != nil {
+		return fmt.Errorf("failed to create team_memberships table: %w", err)
+	}
+
 	// Create key_values table for integration tests
 	createKeyValuesSQL := `
 		CREATE TABLE key_values (
@@ -1452,7 +2675,7 @@ func insertTestData(db *sql.DB) error {
 }
 
 func truncateTestTables(db *sql.DB) error {
-	_, err := db.Exec("TRUNCATE TABLE key_values; TRUNCATE TABLE users;")
+	_, err := db.Exec("TRUNCATE TABLE key_values; TRUNCATE TABLE users; TRUNCATE TABLE sessions; TRUNCATE TABLE team_memberships;")
 	return err
 }
 
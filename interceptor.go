@@ -0,0 +1,205 @@
+package dbmap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"time"
+)
+
+type (
+	// Operation is the kind of statement executed by DB.
+	Operation string
+
+	// Statement describes a statement executed by DB. Interceptors can modify
+	// SQL and Args to rewrite the statement before it is executed.
+	Statement struct {
+		// Operation is the kind of statement, e.g. OpSelect.
+		Operation Operation
+		// Table is the model's table name. Empty for Query and Exec.
+		Table string
+		// Model is the model's struct type. Nil for Query and Exec.
+		Model reflect.Type
+		// Fragment is the query fragment, or SQL for Query and Exec, with
+		// named parameters as it was passed to DB. Empty for statements that
+		// are fully generated, like the INSERT statement of InsertRecord.
+		Fragment string
+		// SQL is the statement executed by the database.
+		SQL string
+		// Args are the positional arguments of SQL.
+		Args []any
+		// NamedArgs describe Args as they were bound, naming each argument
+		// after its named parameter, or its column for generated statements.
+		// They aren't updated when interceptors modify Args.
+		NamedArgs []NamedArg
+
+		// caller is the file:line that called DB, captured before the
+		// statement runs through the interceptors, so it isn't one of them.
+		caller string
+		// consumerTime is the time SelectIter's caller spent handling rows,
+		// which is excluded from the statement's duration.
+		consumerTime time.Duration
+	}
+
+	// NamedArg is an argument of a Statement.
+	NamedArg struct {
+		// Name is the named parameter, e.g. `id` for `$id`, or the column name
+		// for arguments of generated statements.
+		Name string
+		// Value is the argument passed to the database.
+		Value any
+		// Sensitive is true for arguments of columns tagged with the
+		// `sensitive` option, either of the statement's model or of the struct
+		// passed as named parameters. See DB.Redactor.
+		Sensitive bool
+	}
+
+	// Result describes the outcome of a statement.
+	Result struct {
+		// RowsAffected is the number of rows inserted, updated, or deleted.
+		RowsAffected int64
+		// RowsReturned is the number of rows read from the result set. It is
+		// always 0 for Query, since the caller reads the rows.
+		RowsReturned int64
+		// LastInsertID is the ID generated by an insert, for drivers reporting
+		// it like MySQL. Interceptors short-circuiting inserts can set it, so
+		// the ID is populated like it would be by the database.
+		LastInsertID int64
+	}
+
+	// Handler executes a statement.
+	Handler func(ctx context.Context, stmt *Statement) (Result, error)
+
+	// Interceptor is called around every statement executed by DB. It can
+	// observe or modify the statement before calling next to execute it,
+	// observe the result, or short-circuit execution by returning without
+	// calling next.
+	//
+	// Statements that read rows, like those of Select, are read within next,
+	// so the result includes the number of rows returned.
+	Interceptor func(ctx context.Context, stmt *Statement, next Handler) (Result, error)
+
+	// interceptedResult is the sql.Result of an Exec statement that was
+	// short-circuited by an interceptor.
+	interceptedResult struct {
+		result Result
+	}
+)
+
+const (
+	// OpSelect is used by Select, SelectIter, Exists, and Count.
+	OpSelect Operation = "select"
+	// OpInsert is used by InsertRecord, InsertRecords, and Upsert.
+	OpInsert Operation = "insert"
+	// OpUpdate is used by Update and UpdateRecord.
+	OpUpdate Operation = "update"
+	// OpDelete is used by Delete, DeleteRecord, and DeleteRecords.
+	OpDelete Operation = "delete"
+	// OpRaw is used by Query and Exec.
+	OpRaw Operation = "raw"
+)
+
+var errQueryIntercepted = errors.New("query was not executed by interceptors")
+
+// newStatement creates a Statement for the model, which is nil for raw
+// statements, executing query with the arguments of vars.
+func newStatement(op Operation, model *modelType, fragment string, query string, vars *bindVars) *Statement {
+	stmt := &Statement{
+		Operation: op,
+		Fragment:  fragment,
+		SQL:       query,
+		Args:      vars.args,
+		NamedArgs: vars.named,
+	}
+	if model == nil {
+		return stmt
+	}
+
+	stmt.Table = model.tableName
+	stmt.Model = model.elemType
+	for i, arg := range stmt.NamedArgs {
+		if model.sensitive[arg.Name] {
+			stmt.NamedArgs[i].Sensitive = true
+		}
+	}
+
+	return stmt
+}
+
+// elapsed returns the time spent executing the statement since start,
+// excluding the time spent by SelectIter's caller handling rows.
+func (s *Statement) elapsed(start time.Time) time.Duration {
+	return time.Since(start) - s.consumerTime
+}
+
+// execute calls handler through the interceptors, where the first interceptor
+// is the outermost. Statements are commented, traced, logged, recorded in
+// metrics and query scopes, and reported when slow as they are executed by
+// handler, whose driver errors are translated by the dialect.
+func (d *DB) execute(ctx context.Context, stmt *Statement, handler Handler) (Result, error) {
+	if d.SlowQueryThreshold > 0 && stmt.caller == "" {
+		stmt.caller = caller()
+	}
+
+	handler = d.translateErrors(handler)
+	handler = d.trackRepeated(handler)
+	if d.Metrics != nil {
+		handler = d.recordMetrics(handler)
+	}
+	if d.SlowQueryThreshold > 0 {
+		handler = d.reportSlow(handler)
+	}
+	if d.Logger != nil {
+		handler = d.logStatement(handler)
+	}
+	if d.Tracer != nil {
+		handler = d.traceStatement(handler)
+	}
+	if d.CommentProvider != nil {
+		handler = d.commentStatement(handler)
+	}
+
+	for i := len(d.Interceptors) - 1; i >= 0; i-- {
+		interceptor, next := d.Interceptors[i], handler
+		handler = func(ctx context.Context, stmt *Statement) (Result, error) {
+			return interceptor(ctx, stmt, next)
+		}
+	}
+
+	return handler(ctx, stmt)
+}
+
+// exec executes a statement that doesn't return rows through the
+// interceptors.
+func (d *DB) exec(ctx context.Context, stmt *Statement) (sql.Result, error) {
+	var res sql.Result
+	result, err := d.execute(ctx, stmt, func(ctx context.Context, stmt *Statement) (Result, error) {
+		var err error
+		res, err = d.db.ExecContext(ctx, stmt.SQL, stmt.Args...)
+		if err != nil {
+			return Result{}, err
+		}
+
+		n, _ := res.RowsAffected()
+		id, _ := res.LastInsertId()
+		return Result{RowsAffected: n, LastInsertID: id}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if res == nil {
+		return interceptedResult{result: result}, nil
+	}
+
+	return res, nil
+}
+
+func (r interceptedResult) LastInsertId() (int64, error) {
+	return r.result.LastInsertID, nil
+}
+
+func (r interceptedResult) RowsAffected() (int64, error) {
+	return r.result.RowsAffected, nil
+}
@@ -0,0 +1,104 @@
+package dbmap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDB_execute(t *testing.T) {
+	t.Run("calls interceptors outermost first", func(t *testing.T) {
+		var calls []string
+		record := func(name string) Interceptor {
+			return func(ctx context.Context, stmt *Statement, next Handler) (Result, error) {
+				calls = append(calls, "before "+name)
+				result, err := next(ctx, stmt)
+				calls = append(calls, "after "+name)
+
+				return result, err
+			}
+		}
+
+		db := &DB{Interceptors: []Interceptor{record("first"), record("second")}}
+		result, err := db.execute(context.Background(), &Statement{}, func(context.Context, *Statement) (Result, error) {
+			calls = append(calls, "handler")
+			return Result{RowsReturned: 2}, nil
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, Result{RowsReturned: 2}, result)
+		require.Equal(t, []string{"before first", "before second", "handler", "after second", "after first"}, calls)
+	})
+
+	t.Run("passes modified statements to the handler", func(t *testing.T) {
+		db := &DB{Interceptors: []Interceptor{
+			func(ctx context.Context, stmt *Statement, next Handler) (Result, error) {
+				stmt.SQL = "/* tagged */ " + stmt.SQL
+				stmt.Args = append(stmt.Args, 2)
+
+				return next(ctx, stmt)
+			},
+		}}
+
+		var executed *Statement
+		_, err := db.execute(context.Background(), &Statement{SQL: "SELECT ?", Args: []any{1}}, func(_ context.Context, stmt *Statement) (Result, error) {
+			executed = stmt
+			return Result{}, nil
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, "/* tagged */ SELECT ?", executed.SQL)
+		require.Equal(t, []any{1, 2}, executed.Args)
+	})
+
+	t.Run("short-circuits without calling next", func(t *testing.T) {
+		db := &DB{Interceptors: []Interceptor{
+			func(context.Context, *Statement, Handler) (Result, error) {
+				return Result{RowsAffected: 3}, nil
+			},
+		}}
+
+		res, err := db.exec(context.Background(), &Statement{SQL: "DELETE FROM users"})
+		require.NoError(t, err)
+
+		n, err := res.RowsAffected()
+		require.NoError(t, err)
+		require.Equal(t, int64(3), n)
+
+		id, err := res.LastInsertId()
+		require.NoError(t, err)
+		require.Zero(t, id)
+	})
+
+	t.Run("short-circuits inserts with a generated ID", func(t *testing.T) {
+		db := New(nil)
+		db.Interceptors = []Interceptor{
+			func(context.Context, *Statement, Handler) (Result, error) {
+				return Result{RowsAffected: 1, LastInsertID: 42}, nil
+			},
+		}
+
+		model := &interceptedModel{}
+		require.NoError(t, db.InsertRecord(context.Background(), model))
+		require.Equal(t, 42, model.ID)
+	})
+}
+
+type interceptedModel struct {
+	ID int `db:"id"`
+}
+
+func TestNewStatement(t *testing.T) {
+	model, err := newModelType(&[]interceptedModel{}, defaultPluralizer)
+	require.NoError(t, err)
+
+	stmt := newStatement(OpSelect, model, "WHERE id = $id", "SELECT ...", &bindVars{args: []any{1}})
+	require.Equal(t, OpSelect, stmt.Operation)
+	require.Equal(t, "intercepted_models", stmt.Table)
+	require.Equal(t, "interceptedModel", stmt.Model.Name())
+
+	stmt = newStatement(OpRaw, nil, "SELECT 1", "SELECT 1", &bindVars{})
+	require.Empty(t, stmt.Table)
+	require.Nil(t, stmt.Model)
+}
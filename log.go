@@ -0,0 +1,88 @@
+package dbmap
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// redacted replaces the values of sensitive arguments in logs.
+const redacted = "[REDACTED]"
+
+// logStatement wraps handler to log the statement it executes using
+// d.Logger. Successful statements are logged at debug level, and failed
+// statements at error level.
+func (d *DB) logStatement(handler Handler) Handler {
+	return func(ctx context.Context, stmt *Statement) (Result, error) {
+		start := time.Now()
+		result, err := handler(ctx, stmt)
+		duration := stmt.elapsed(start)
+
+		level, message := slog.LevelDebug, "executed statement"
+		if err != nil {
+			level, message = slog.LevelError, "statement failed"
+		}
+		if !d.Logger.Enabled(ctx, level) {
+			return result, err
+		}
+
+		attrs := []slog.Attr{slog.String("operation", string(stmt.Operation))}
+		if stmt.Table != "" {
+			attrs = append(attrs, slog.String("table", stmt.Table))
+		}
+		attrs = append(attrs,
+			slog.String("sql", stmt.SQL),
+			slog.Duration("duration", duration),
+			slog.Int64("rows_affected", result.RowsAffected),
+			slog.Int64("rows_returned", result.RowsReturned),
+		)
+		if len(stmt.NamedArgs) > 0 {
+			attrs = append(attrs, slog.Any("args", d.logArgs(stmt)))
+		}
+		if err != nil {
+			attrs = append(attrs, slog.Any("error", err))
+		}
+
+		d.Logger.LogAttrs(ctx, level, message, attrs...)
+
+		return result, err
+	}
+}
+
+// logArgs returns the redacted named arguments of the statement as a group.
+// Arguments sharing a name, like the expanded values of a slice parameter, or
+// a column of a multi-row insert, are logged as a list.
+func (d *DB) logArgs(stmt *Statement) slog.Value {
+	var names []string
+	values := make(map[string][]any, len(stmt.NamedArgs))
+	for _, arg := range stmt.NamedArgs {
+		if _, ok := values[arg.Name]; !ok {
+			names = append(names, arg.Name)
+		}
+		values[arg.Name] = append(values[arg.Name], d.redact(arg))
+	}
+
+	attrs := make([]slog.Attr, 0, len(names))
+	for _, name := range names {
+		if len(values[name]) == 1 {
+			attrs = append(attrs, slog.Any(name, values[name][0]))
+		} else {
+			attrs = append(attrs, slog.Any(name, values[name]))
+		}
+	}
+
+	return slog.GroupValue(attrs...)
+}
+
+// redact returns the value of arg to log. Sensitive arguments are always
+// redacted, while other arguments are passed to d.Redactor when set.
+func (d *DB) redact(arg NamedArg) any {
+	if arg.Sensitive {
+		return redacted
+	}
+	if d.Redactor != nil {
+		return d.Redactor(arg)
+	}
+
+	return arg.Value
+}
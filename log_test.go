@@ -0,0 +1,139 @@
+package dbmap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type loggedUser struct {
+	ID       int    `db:"id"`
+	Name     string `db:"name"`
+	Password string `db:"password,sensitive"`
+}
+
+func TestDB_logStatement(t *testing.T) {
+	newLoggedDB := func(buf *bytes.Buffer) *DB {
+		db := New(nil)
+		db.Logger = slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+		return db
+	}
+	decode := func(t *testing.T, buf *bytes.Buffer) map[string]any {
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+		return entry
+	}
+
+	t.Run("logs statements", func(t *testing.T) {
+		var buf bytes.Buffer
+		db := newLoggedDB(&buf)
+		model, err := newModelType(&loggedUser{}, defaultPluralizer)
+		require.NoError(t, err)
+
+		query, vars, err := db.bindQuery("WHERE name = $name AND id IN ($ids)", Args{"name": "Fox", "ids": []int{1, 2}})
+		require.NoError(t, err)
+
+		_, err = db.execute(context.Background(), newStatement(OpSelect, model, "", query, vars), func(context.Context, *Statement) (Result, error) {
+			return Result{RowsReturned: 2}, nil
+		})
+		require.NoError(t, err)
+
+		entry := decode(t, &buf)
+		require.Equal(t, "DEBUG", entry["level"])
+		require.Equal(t, "executed statement", entry["msg"])
+		require.Equal(t, "select", entry["operation"])
+		require.Equal(t, "logged_users", entry["table"])
+		require.Equal(t, "WHERE name = ? AND id IN (?, ?)", entry["sql"])
+		require.Equal(t, float64(2), entry["rows_returned"])
+		require.Equal(t, map[string]any{"name": "Fox", "ids": []any{float64(1), float64(2)}}, entry["args"])
+	})
+
+	t.Run("logs failed statements as errors", func(t *testing.T) {
+		var buf bytes.Buffer
+		db := newLoggedDB(&buf)
+
+		_, err := db.execute(context.Background(), &Statement{Operation: OpRaw, SQL: "DELETE FROM users"}, func(context.Context, *Statement) (Result, error) {
+			return Result{}, errors.New("boom")
+		})
+		require.EqualError(t, err, "boom")
+
+		entry := decode(t, &buf)
+		require.Equal(t, "ERROR", entry["level"])
+		require.Equal(t, "boom", entry["error"])
+		require.NotContains(t, entry, "table")
+		require.NotContains(t, entry, "args")
+	})
+
+	t.Run("redacts sensitive columns of the model", func(t *testing.T) {
+		var buf bytes.Buffer
+		db := newLoggedDB(&buf)
+		model, err := newModelType(&loggedUser{}, defaultPluralizer)
+		require.NoError(t, err)
+
+		query, vars, err := db.bindQuery("WHERE password = $password", Args{"password": "hunter2"})
+		require.NoError(t, err)
+
+		_, err = db.execute(context.Background(), newStatement(OpSelect, model, "", query, vars), func(context.Context, *Statement) (Result, error) {
+			return Result{}, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"password": redacted}, decode(t, &buf)["args"])
+	})
+
+	t.Run("redacts sensitive columns of struct parameters", func(t *testing.T) {
+		var buf bytes.Buffer
+		db := newLoggedDB(&buf)
+
+		query, vars, err := db.bindQuery("WHERE name = $name AND password = $Password", loggedUser{Name: "Fox", Password: "hunter2"})
+		require.NoError(t, err)
+
+		_, err = db.execute(context.Background(), newStatement(OpRaw, nil, "", query, vars), func(context.Context, *Statement) (Result, error) {
+			return Result{}, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"name": "Fox", "Password": redacted}, decode(t, &buf)["args"])
+	})
+
+	t.Run("redacts arguments using Redactor", func(t *testing.T) {
+		var buf bytes.Buffer
+		db := newLoggedDB(&buf)
+		db.Redactor = func(arg NamedArg) any {
+			if arg.Name == "token" {
+				return "***"
+			}
+			return arg.Value
+		}
+
+		query, vars, err := db.bindQuery("WHERE token = $token AND name = $name", Args{"token": "abc", "name": "Fox"})
+		require.NoError(t, err)
+
+		_, err = db.execute(context.Background(), newStatement(OpRaw, nil, "", query, vars), func(context.Context, *Statement) (Result, error) {
+			return Result{}, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"token": "***", "name": "Fox"}, decode(t, &buf)["args"])
+	})
+
+	t.Run("doesn't log short-circuited statements", func(t *testing.T) {
+		var buf bytes.Buffer
+		db := newLoggedDB(&buf)
+		db.Interceptors = []Interceptor{
+			func(context.Context, *Statement, Handler) (Result, error) {
+				return Result{}, nil
+			},
+		}
+
+		_, err := db.execute(context.Background(), &Statement{}, func(context.Context, *Statement) (Result, error) {
+			t.Fatal("handler should not be called")
+			return Result{}, nil
+		})
+		require.NoError(t, err)
+		require.Empty(t, buf.String())
+	})
+}
@@ -0,0 +1,207 @@
+package dbmap
+
+import (
+	"cmp"
+	"context"
+	"expvar"
+	"slices"
+	"sync"
+	"time"
+)
+
+type (
+	// Metrics records the statements executed by DB, e.g. to export them to
+	// a metrics system. See MetricsCollector.
+	Metrics interface {
+		RecordStatement(ctx context.Context, metric StatementMetric)
+	}
+
+	// StatementMetric describes a statement executed by DB.
+	StatementMetric struct {
+		// Table is the table of the statement's model. Empty for Query and
+		// Exec.
+		Table string
+		// Operation is the kind of statement, e.g. OpSelect.
+		Operation Operation
+		// Duration is the time the database took to execute the statement.
+		Duration time.Duration
+		// Result is the result of the statement.
+		Result Result
+		// Err is the error returned by the statement, if any.
+		Err error
+	}
+
+	// MetricsCollector is a Metrics implementation aggregating statements in
+	// memory by table and operation. Use Snapshot to read the aggregates, or
+	// Publish to export them using expvar. The zero value uses
+	// DefaultLatencyBounds.
+	MetricsCollector struct {
+		bounds []time.Duration
+
+		mu    sync.Mutex
+		stats map[metricsKey]*StatementStats
+	}
+
+	// StatementStats are the aggregated metrics of the statements of a table
+	// and operation.
+	StatementStats struct {
+		Table     string    `json:"table"`
+		Operation Operation `json:"operation"`
+		// Count is the number of statements executed, including failed ones.
+		Count int64 `json:"count"`
+		// Errors is the number of statements that returned an error.
+		Errors       int64 `json:"errors"`
+		RowsAffected int64 `json:"rows_affected"`
+		RowsReturned int64 `json:"rows_returned"`
+		// Latency is the distribution of the statements' durations.
+		Latency Histogram `json:"latency"`
+	}
+
+	// Histogram counts durations in buckets.
+	Histogram struct {
+		// Bounds are the inclusive upper bounds of the buckets, in ascending
+		// order.
+		Bounds []time.Duration `json:"bounds"`
+		// Counts are the number of durations in each bucket. Counts[i] counts
+		// durations above Bounds[i-1], up to Bounds[i]. The final count, at
+		// index len(Bounds), counts durations above the last bound.
+		Counts []int64 `json:"counts"`
+		// Sum is the total of all durations.
+		Sum time.Duration `json:"sum"`
+	}
+
+	// metricsKey identifies the StatementStats of a table and operation.
+	metricsKey struct {
+		table     string
+		operation Operation
+	}
+)
+
+// DefaultLatencyBounds are the histogram bounds used by MetricsCollector when
+// none are given.
+var DefaultLatencyBounds = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+var _ Metrics = (*MetricsCollector)(nil)
+
+// recordMetrics wraps handler to record the statement it executes using
+// d.Metrics.
+func (d *DB) recordMetrics(handler Handler) Handler {
+	return func(ctx context.Context, stmt *Statement) (Result, error) {
+		start := time.Now()
+		result, err := handler(ctx, stmt)
+
+		d.Metrics.RecordStatement(ctx, StatementMetric{
+			Table:     stmt.Table,
+			Operation: stmt.Operation,
+			Duration:  stmt.elapsed(start),
+			Result:    result,
+			Err:       err,
+		})
+
+		return result, err
+	}
+}
+
+// NewMetricsCollector returns a MetricsCollector recording latencies using the
+// given histogram bounds, or DefaultLatencyBounds when none are given.
+func NewMetricsCollector(bounds ...time.Duration) *MetricsCollector {
+	if len(bounds) == 0 {
+		bounds = DefaultLatencyBounds
+	}
+	bounds = slices.Clone(bounds)
+	slices.Sort(bounds)
+
+	return &MetricsCollector{bounds: bounds}
+}
+
+// RecordStatement adds the statement to the aggregates of its table and
+// operation.
+func (c *MetricsCollector) RecordStatement(_ context.Context, metric StatementMetric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stats == nil {
+		c.stats = make(map[metricsKey]*StatementStats)
+	}
+	if c.bounds == nil {
+		// Cloned like NewMetricsCollector does, since DefaultLatencyBounds can
+		// be modified.
+		c.bounds = slices.Clone(DefaultLatencyBounds)
+		slices.Sort(c.bounds)
+	}
+
+	key := metricsKey{table: metric.Table, operation: metric.Operation}
+	stats, ok := c.stats[key]
+	if !ok {
+		stats = &StatementStats{
+			Table:     metric.Table,
+			Operation: metric.Operation,
+			Latency: Histogram{
+				Bounds: c.bounds,
+				Counts: make([]int64, len(c.bounds)+1),
+			},
+		}
+		c.stats[key] = stats
+	}
+
+	stats.Count++
+	if metric.Err != nil {
+		stats.Errors++
+	}
+	stats.RowsAffected += metric.Result.RowsAffected
+	stats.RowsReturned += metric.Result.RowsReturned
+
+	bucket, _ := slices.BinarySearch(c.bounds, metric.Duration)
+	stats.Latency.Counts[bucket]++
+	stats.Latency.Sum += metric.Duration
+}
+
+// Snapshot returns a copy of the aggregates, sorted by table and operation.
+func (c *MetricsCollector) Snapshot() []StatementStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot := make([]StatementStats, 0, len(c.stats))
+	for _, stats := range c.stats {
+		stats := *stats
+		stats.Latency.Bounds = slices.Clone(stats.Latency.Bounds)
+		stats.Latency.Counts = slices.Clone(stats.Latency.Counts)
+		snapshot = append(snapshot, stats)
+	}
+
+	slices.SortFunc(snapshot, func(a, b StatementStats) int {
+		return cmp.Or(cmp.Compare(a.Table, b.Table), cmp.Compare(a.Operation, b.Operation))
+	})
+
+	return snapshot
+}
+
+// Reset discards the aggregates.
+func (c *MetricsCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.stats)
+}
+
+// Publish exports the snapshot of the collector as an expvar variable, e.g.
+// served as JSON at /debug/vars. Like expvar.Publish, it panics when the name
+// is already in use.
+func (c *MetricsCollector) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return c.Snapshot()
+	}))
+}
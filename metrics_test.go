@@ -0,0 +1,101 @@
+package dbmap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsCollector(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("aggregates statements by table and operation", func(t *testing.T) {
+		collector := NewMetricsCollector(10*time.Millisecond, time.Millisecond)
+
+		collector.RecordStatement(ctx, StatementMetric{Table: "users", Operation: OpSelect, Duration: time.Millisecond, Result: Result{RowsReturned: 2}})
+		collector.RecordStatement(ctx, StatementMetric{Table: "users", Operation: OpSelect, Duration: 5 * time.Millisecond, Err: errors.New("boom")})
+		collector.RecordStatement(ctx, StatementMetric{Table: "users", Operation: OpSelect, Duration: time.Second, Result: Result{RowsReturned: 1}})
+		collector.RecordStatement(ctx, StatementMetric{Table: "posts", Operation: OpDelete, Duration: time.Microsecond, Result: Result{RowsAffected: 3}})
+
+		bounds := []time.Duration{time.Millisecond, 10 * time.Millisecond}
+		require.Equal(t, []StatementStats{
+			{
+				Table:        "posts",
+				Operation:    OpDelete,
+				Count:        1,
+				RowsAffected: 3,
+				Latency:      Histogram{Bounds: bounds, Counts: []int64{1, 0, 0}, Sum: time.Microsecond},
+			},
+			{
+				Table:        "users",
+				Operation:    OpSelect,
+				Count:        3,
+				Errors:       1,
+				RowsReturned: 3,
+				Latency:      Histogram{Bounds: bounds, Counts: []int64{1, 1, 1}, Sum: 1006 * time.Millisecond},
+			},
+		}, collector.Snapshot())
+
+		collector.Reset()
+		require.Empty(t, collector.Snapshot())
+	})
+
+	t.Run("zero value uses the default bounds", func(t *testing.T) {
+		var collector MetricsCollector
+		collector.RecordStatement(ctx, StatementMetric{Operation: OpRaw, Duration: time.Minute})
+
+		snapshot := collector.Snapshot()
+		require.Len(t, snapshot, 1)
+		require.Equal(t, DefaultLatencyBounds, snapshot[0].Latency.Bounds)
+		require.Equal(t, int64(1), snapshot[0].Latency.Counts[len(DefaultLatencyBounds)])
+	})
+
+	t.Run("snapshots don't share the collector's bounds", func(t *testing.T) {
+		defaults := slices.Clone(DefaultLatencyBounds)
+		t.Cleanup(func() { DefaultLatencyBounds = defaults })
+
+		var collector MetricsCollector
+		collector.RecordStatement(ctx, StatementMetric{Operation: OpRaw, Duration: time.Millisecond})
+
+		DefaultLatencyBounds[0] = time.Hour
+		collector.Snapshot()[0].Latency.Bounds[0] = time.Hour
+
+		collector.RecordStatement(ctx, StatementMetric{Operation: OpRaw, Duration: 2 * time.Millisecond})
+		snapshot := collector.Snapshot()
+		require.Equal(t, defaults, snapshot[0].Latency.Bounds)
+		require.Equal(t, []int64{1, 1}, snapshot[0].Latency.Counts[:2])
+	})
+
+	t.Run("publishes the snapshot using expvar", func(t *testing.T) {
+		collector := NewMetricsCollector()
+		collector.RecordStatement(ctx, StatementMetric{Table: "users", Operation: OpInsert, Result: Result{RowsAffected: 1}})
+		collector.Publish("dbmap_test_metrics")
+
+		var published []StatementStats
+		require.NoError(t, json.Unmarshal([]byte(expvar.Get("dbmap_test_metrics").String()), &published))
+		require.Equal(t, collector.Snapshot(), published)
+	})
+}
+
+func TestDB_recordMetrics(t *testing.T) {
+	collector := NewMetricsCollector()
+	db := &DB{Metrics: collector}
+
+	_, err := db.execute(context.Background(), &Statement{Operation: OpUpdate, Table: "users"}, func(context.Context, *Statement) (Result, error) {
+		return Result{RowsAffected: 2}, nil
+	})
+	require.NoError(t, err)
+
+	snapshot := collector.Snapshot()
+	require.Len(t, snapshot, 1)
+	require.Equal(t, "users", snapshot[0].Table)
+	require.Equal(t, OpUpdate, snapshot[0].Operation)
+	require.Equal(t, int64(1), snapshot[0].Count)
+	require.Equal(t, int64(2), snapshot[0].RowsAffected)
+}
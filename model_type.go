@@ -3,6 +3,7 @@ package dbmap
 import (
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 )
 
@@ -14,6 +15,13 @@ type modelType struct {
 	// baseType is the type passed directly to DB methods, e.g. *[]User or []*User
 	baseType reflect.Type
 
+	// idColumn is the column of the generated ID, e.g. `id`. Composite
+	// primary keys have no generated ID.
+	idColumn string
+	// primaryKey contains the primary key columns, which has multiple entries
+	// for composite primary keys.
+	primaryKey []column
+
 	idFieldIndex        int
 	createdAtFieldIndex int
 	updatedAtFieldIndex int
@@ -23,7 +31,30 @@ type modelType struct {
 	isStructPointer   bool
 	isStruct          bool
 	isValidSlice      bool
-	columns           []reflect.StructField
+	columns           []column
+
+	// hooks are the lifecycle hooks implemented by the model
+	hooks hooks
+	// validations are the rules of the model's `validate` tags
+	validations         []fieldRules
+	implementsValidator bool
+	// sensitive contains the field and column names of columns tagged with
+	// the `sensitive` option, whose values are redacted from logs
+	sensitive map[string]bool
+}
+
+// column is a struct field that maps to a database column
+type column struct {
+	reflect.StructField
+
+	// name is the database column name, e.g. `created_at`
+	name string
+	// hasDefault is true when the column is tagged with the `default` option,
+	// meaning the database provides a value when none is given.
+	hasDefault bool
+	// sensitive is true when the column is tagged with the `sensitive`
+	// option, meaning its values are redacted from logs.
+	sensitive bool
 }
 
 var errInvalidType = fmt.Errorf("destination must be a struct, or a slice of structs")
@@ -64,7 +95,8 @@ func newModelType(t any, pluralizer Pluralizer) (*modelType, error) {
 		isStructPointer:   determineIsStructPointer(baseType),
 		isStruct:          determineIsStruct(baseType),
 		isValidSlice:      determineIsValidSlice(baseType, elemType),
-		columns:           make([]reflect.StructField, 0, elemType.NumField()),
+		columns:           make([]column, 0, elemType.NumField()),
+		hooks:             findHooks(elemType),
 
 		// indexes will get replaced with real values if found in the `findColumns` call below
 		idFieldIndex:        -1,
@@ -74,10 +106,25 @@ func newModelType(t any, pluralizer Pluralizer) (*modelType, error) {
 
 	findColumns(model, elemType)
 
+	for _, col := range model.columns {
+		if col.hasDefault && !supportsDefault(col.Type) {
+			return nil, fmt.Errorf("invalid db tag on field %s: default is not supported for %s, since its zero value couldn't be inserted; use a pointer instead", col.Name, col.Type)
+		}
+	}
+
+	validations, err := parseValidations(model.columns)
+	if err != nil {
+		return nil, err
+	}
+	model.validations = validations
+	model.implementsValidator = reflect.PointerTo(elemType).Implements(validatorType)
+
 	return model, nil
 }
 
 func findColumns(m *modelType, elem reflect.Type) {
+	var pkColumns []column
+
 	for i := range elem.NumField() {
 		field := elem.Field(i)
 		if !field.IsExported() {
@@ -89,20 +136,141 @@ func findColumns(m *modelType, elem reflect.Type) {
 			continue
 		}
 
-		if (field.Tag.Get("db") == "" && (field.Name == "ID")) || field.Tag.Get("db") == "id" {
+		tagName, options := parseDBTag(field)
+
+		if (tagName == "" && (field.Name == "ID")) || tagName == "id" {
 			m.idFieldIndex = i
+			m.idColumn = "id"
 		}
 
-		if (field.Tag.Get("db") == "" && (field.Name == "CreatedAt")) || field.Tag.Get("db") == "created_at" {
+		if (tagName == "" && (field.Name == "CreatedAt")) || tagName == "created_at" {
 			m.createdAtFieldIndex = i
 		}
 
-		if (field.Tag.Get("db") == "" && (field.Name == "UpdatedAt")) || field.Tag.Get("db") == "updated_at" {
+		if (tagName == "" && (field.Name == "UpdatedAt")) || tagName == "updated_at" {
 			m.updatedAtFieldIndex = i
 		}
 
-		m.columns = append(m.columns, field)
+		col := column{
+			StructField: field,
+			name:        columnName(field),
+			hasDefault:  slices.Contains(options, "default"),
+			sensitive:   slices.Contains(options, "sensitive"),
+		}
+		if slices.Contains(options, "pk") {
+			pkColumns = append(pkColumns, col)
+		}
+		if col.sensitive {
+			if m.sensitive == nil {
+				m.sensitive = make(map[string]bool)
+			}
+			m.sensitive[col.Name] = true
+			m.sensitive[col.name] = true
+		}
+
+		m.columns = append(m.columns, col)
 	}
+
+	// Fields tagged with the `pk` option take precedence over fields named ID
+	// or tagged as the `id` column. Multiple `pk` fields form a composite
+	// primary key, which doesn't have a generated ID.
+	switch {
+	case len(pkColumns) == 1:
+		m.idFieldIndex = pkColumns[0].Index[0]
+		m.idColumn = pkColumns[0].name
+		m.primaryKey = pkColumns
+	case len(pkColumns) > 1:
+		m.idFieldIndex = -1
+		m.idColumn = ""
+		m.primaryKey = pkColumns
+	case m.idFieldIndex >= 0:
+		m.primaryKey = []column{{
+			StructField: elem.Field(m.idFieldIndex),
+			name:        m.idColumn,
+		}}
+	}
+}
+
+// parseDBTag returns the name and options of a field's `db` tag, e.g.
+// `db:"user_uuid,pk"`. The name is empty when the tag does not provide one.
+//
+// Supported options are `pk`, marking the primary key (or part of a composite
+// primary key), `default`, marking columns the database provides a value for,
+// and `sensitive`, marking columns whose values are redacted from logs.
+func parseDBTag(field reflect.StructField) (string, []string) {
+	name, rawOptions, _ := strings.Cut(field.Tag.Get("db"), ",")
+
+	var options []string
+	if rawOptions != "" {
+		options = strings.Split(rawOptions, ",")
+	}
+
+	return name, options
+}
+
+// columnName returns the database column name for the field, falling back to
+// the snake_cased field name when the `db` tag does not provide one.
+func columnName(field reflect.StructField) string {
+	name, _ := parseDBTag(field)
+	if name == "" {
+		return snake_case(field.Name)
+	}
+	return name
+}
+
+// supportsDefault reports whether the `default` option can be used with
+// fields of type t. Zero valued `default` fields are omitted from inserts, so
+// bools and numbers, whose zero values are meaningful, like false, must use a
+// pointer where nil means the database default.
+func supportsDefault(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return false
+	default:
+		return true
+	}
+}
+
+// integerIDColumn returns the ID column when its field is an integer, which
+// databases can generate, or an empty string otherwise.
+func (m *modelType) integerIDColumn() string {
+	if m.idFieldIndex < 0 {
+		return ""
+	}
+
+	switch m.elemType.Field(m.idFieldIndex).Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return m.idColumn
+	default:
+		return ""
+	}
+}
+
+// isGenerated reports whether the database can generate the column's value,
+// either because it's the ID column or it's tagged with the `default` option.
+func (m *modelType) isGenerated(col column) bool {
+	return col.hasDefault || col.Index[0] == m.idFieldIndex
+}
+
+// columnNames returns the column names for the given struct field or column
+// names.
+func (m *modelType) columnNames(names []string) ([]string, error) {
+	columnNames := make([]string, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(m.columns, func(col column) bool {
+			return col.Name == name || col.name == name
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+		columnNames = append(columnNames, m.columns[i].name)
+	}
+
+	return columnNames, nil
 }
 
 func (m *modelType) FieldType(i int) reflect.StructField {
@@ -0,0 +1,134 @@
+package dbmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewModelType_primaryKey(t *testing.T) {
+	t.Run("defaults to the id column", func(t *testing.T) {
+		type TestStruct struct {
+			ID   int    `db:"id"`
+			Name string `db:"name"`
+		}
+
+		model, err := newModelType(&TestStruct{}, defaultPluralizer)
+		require.NoError(t, err)
+		require.Equal(t, 0, model.idFieldIndex)
+		require.Equal(t, "id", model.idColumn)
+	})
+
+	t.Run("uses the pk tag option", func(t *testing.T) {
+		type TestStruct struct {
+			ID   int    `db:"id"`
+			UUID string `db:"user_uuid,pk"`
+		}
+
+		model, err := newModelType(&TestStruct{}, defaultPluralizer)
+		require.NoError(t, err)
+		require.Equal(t, 1, model.idFieldIndex)
+		require.Equal(t, "user_uuid", model.idColumn)
+		require.Equal(t, "user_uuid", model.columns[1].name)
+	})
+
+	t.Run("uses the pk tag option without a column name", func(t *testing.T) {
+		type TestStruct struct {
+			SessionKey string `db:",pk"`
+		}
+
+		model, err := newModelType(&TestStruct{}, defaultPluralizer)
+		require.NoError(t, err)
+		require.Equal(t, 0, model.idFieldIndex)
+		require.Equal(t, "session_key", model.idColumn)
+	})
+
+	t.Run("uses multiple pk tag options as a composite primary key", func(t *testing.T) {
+		type TestStruct struct {
+			TeamID int    `db:"team_id,pk"`
+			UserID int    `db:"user_id,pk"`
+			Role   string `db:"role"`
+		}
+
+		model, err := newModelType(&TestStruct{}, defaultPluralizer)
+		require.NoError(t, err)
+		require.Equal(t, -1, model.idFieldIndex, "composite primary keys have no generated ID")
+		require.Equal(t, "", model.idColumn)
+		require.Len(t, model.primaryKey, 2)
+		require.Equal(t, "team_id", model.primaryKey[0].name)
+		require.Equal(t, "user_id", model.primaryKey[1].name)
+	})
+
+	t.Run("has no primary key", func(t *testing.T) {
+		type TestStruct struct {
+			Name string `db:"name"`
+		}
+
+		model, err := newModelType(&TestStruct{}, defaultPluralizer)
+		require.NoError(t, err)
+		require.Equal(t, -1, model.idFieldIndex)
+		require.Equal(t, "", model.idColumn)
+		require.Empty(t, model.primaryKey)
+	})
+}
+
+func TestNewModelType_defaults(t *testing.T) {
+	type Valid struct {
+		UUID   string `db:"uuid,default"`
+		Active *bool  `db:"active,default"`
+		Score  *int64 `db:"score,default"`
+		Name   string `db:"name"`
+	}
+
+	_, err := newModelType(&Valid{}, defaultPluralizer)
+	require.NoError(t, err)
+
+	type InvalidBool struct {
+		Active bool `db:"active,default"`
+	}
+
+	_, err = newModelType(&InvalidBool{}, defaultPluralizer)
+	require.EqualError(t, err, "invalid db tag on field Active: default is not supported for bool, since its zero value couldn't be inserted; use a pointer instead")
+
+	type InvalidNumber struct {
+		Score int `db:"score,default"`
+	}
+
+	_, err = newModelType(&InvalidNumber{}, defaultPluralizer)
+	require.ErrorContains(t, err, "default is not supported for int")
+}
+
+func TestModelType_integerIDColumn(t *testing.T) {
+	type IntegerID struct {
+		ID int64 `db:"id"`
+	}
+	type StringID struct {
+		ID string `db:"id"`
+	}
+	type StringKey struct {
+		Token string `db:"token,pk"`
+	}
+	type CompositeKey struct {
+		TeamID int `db:"team_id,pk"`
+		UserID int `db:"user_id,pk"`
+	}
+
+	tests := []struct {
+		name     string
+		model    any
+		expected string
+	}{
+		{name: "integer ID", model: &IntegerID{}, expected: "id"},
+		{name: "string ID", model: &StringID{}, expected: ""},
+		{name: "string primary key", model: &StringKey{}, expected: ""},
+		{name: "composite primary key", model: &CompositeKey{}, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := newModelType(tt.model, defaultPluralizer)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, model.integerIDColumn())
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package dbmap
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// QueryScope tracks the Select statements executed with the contexts
+	// returned by WithQueryScope, e.g. within a request or a test, to detect
+	// N+1 queries: the same Select statement executed for each record of a
+	// previous Select.
+	QueryScope struct {
+		mu      sync.Mutex
+		queries map[queryShape]*RepeatedQuery
+		order   []queryShape
+	}
+
+	// RepeatedQuery describes a Select statement shape executed repeatedly
+	// within a QueryScope.
+	RepeatedQuery struct {
+		// Table is the table of the statement's model.
+		Table string
+		// Fragment is the query fragment of the statement, with named
+		// parameters as it was passed to DB.
+		Fragment string
+		// SQL is the SQL of the statement's first execution, which tells
+		// apart statements like those of Count and Select sharing a fragment.
+		SQL string
+		// Count is the number of times the statement was executed.
+		Count int
+		// Stacks are the distinct stack traces the statement was executed
+		// from, excluding dbmap's frames.
+		Stacks []string
+	}
+
+	// TestingT is the subset of testing.TB used by AssertNoRepeatedQueries.
+	TestingT interface {
+		Helper()
+		Errorf(format string, args ...any)
+	}
+
+	// queryShape identifies statements that only differ by their arguments.
+	// prefix is the generated SQL preceding the table, e.g. `SELECT COUNT(*)`,
+	// so Select, Count, and Exists with the same fragment are told apart.
+	queryShape struct {
+		prefix   string
+		table    string
+		fragment string
+	}
+
+	// queryScopeContextKey is the context key of the QueryScope stored by
+	// WithQueryScope.
+	queryScopeContextKey struct{}
+)
+
+// WithQueryScope returns a copy of ctx tracking the Select statements executed
+// with it in the returned QueryScope. Statements of the same method with the
+// same table and query fragment are counted together, regardless of their
+// arguments.
+//
+// When DB.RepeatedQueryThreshold is set, statements executed more often than
+// the threshold within the scope are reported using DB.OnRepeatedQuery.
+func WithQueryScope(ctx context.Context) (context.Context, *QueryScope) {
+	scope := &QueryScope{queries: make(map[queryShape]*RepeatedQuery)}
+	return context.WithValue(ctx, queryScopeContextKey{}, scope), scope
+}
+
+// Repeated returns the Select statements executed more than threshold times
+// within the scope, in the order they were first executed.
+func (s *QueryScope) Repeated(threshold int) []RepeatedQuery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var repeated []RepeatedQuery
+	for _, shape := range s.order {
+		if query := s.queries[shape]; query.Count > threshold {
+			repeated = append(repeated, query.clone())
+		}
+	}
+
+	return repeated
+}
+
+// AssertNoRepeatedQueries reports a test error for each Select statement
+// executed more than threshold times within the scope, including the stacks
+// it was executed from. It returns true when there are none.
+//
+//	ctx, scope := dbmap.WithQueryScope(ctx)
+//	renderPosts(ctx, db)
+//	dbmap.AssertNoRepeatedQueries(t, scope, 1)
+func AssertNoRepeatedQueries(t TestingT, scope *QueryScope, threshold int) bool {
+	t.Helper()
+
+	repeated := scope.Repeated(threshold)
+	for _, query := range repeated {
+		t.Errorf("%s executed %d times, more than %d, from:\n%s", query, query.Count, threshold, strings.Join(query.Stacks, "\n"))
+	}
+
+	return len(repeated) == 0
+}
+
+// record counts an execution of stmt from stack, returning the updated
+// RepeatedQuery.
+func (s *QueryScope) record(stmt *Statement, stack string) RepeatedQuery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix, _, _ := strings.Cut(stmt.SQL, " FROM "+stmt.Table)
+	shape := queryShape{prefix: prefix, table: stmt.Table, fragment: stmt.Fragment}
+	query, ok := s.queries[shape]
+	if !ok {
+		query = &RepeatedQuery{Table: stmt.Table, Fragment: stmt.Fragment, SQL: stmt.SQL}
+		s.queries[shape] = query
+		s.order = append(s.order, shape)
+	}
+
+	query.Count++
+	if !slices.Contains(query.Stacks, stack) {
+		query.Stacks = append(query.Stacks, stack)
+	}
+
+	return query.clone()
+}
+
+func (q RepeatedQuery) clone() RepeatedQuery {
+	q.Stacks = slices.Clone(q.Stacks)
+	return q
+}
+
+func (q RepeatedQuery) String() string {
+	return "SELECT from " + cmp.Or(q.Table, "unknown table") + " " + strconv.Quote(q.Fragment)
+}
+
+// trackRepeated wraps handler to record Select statements in the QueryScope of
+// the context, reporting them once they exceed d.RepeatedQueryThreshold.
+func (d *DB) trackRepeated(handler Handler) Handler {
+	return func(ctx context.Context, stmt *Statement) (Result, error) {
+		scope, ok := ctx.Value(queryScopeContextKey{}).(*QueryScope)
+		if !ok || stmt.Operation != OpSelect {
+			return handler(ctx, stmt)
+		}
+
+		query := scope.record(stmt, callerStack())
+		if d.RepeatedQueryThreshold > 0 && query.Count == d.RepeatedQueryThreshold+1 {
+			if d.OnRepeatedQuery != nil {
+				d.OnRepeatedQuery(ctx, query)
+			} else {
+				d.logRepeated(ctx, query)
+			}
+		}
+
+		return handler(ctx, stmt)
+	}
+}
+
+// logRepeated logs the repeated query at warn level using d.Logger, or
+// slog.Default when d.Logger is nil.
+func (d *DB) logRepeated(ctx context.Context, query RepeatedQuery) {
+	logger := d.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	logger.LogAttrs(ctx, slog.LevelWarn, "repeated query",
+		slog.String("table", query.Table),
+		slog.String("fragment", query.Fragment),
+		slog.String("sql", query.SQL),
+		slog.Int("count", query.Count),
+		slog.Int("threshold", d.RepeatedQueryThreshold),
+		slog.Any("stacks", query.Stacks),
+	)
+}
+
+// callerStack returns the stack trace of the code that called DB, excluding
+// dbmap's frames, with a function and file:line pair per frame.
+func callerStack() string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack strings.Builder
+	for {
+		frame, more := frames.Next()
+		if !isDBMapFrame(frame) {
+			stack.WriteString(frame.Function)
+			stack.WriteString("\n\t")
+			stack.WriteString(frame.File)
+			stack.WriteString(":")
+			stack.WriteString(strconv.Itoa(frame.Line))
+			stack.WriteString("\n")
+		}
+		if !more {
+			return stack.String()
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package dbmap
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingT struct {
+	errors []string
+}
+
+func (*recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestDB_trackRepeated(t *testing.T) {
+	noop := func(context.Context, *Statement) (Result, error) { return Result{}, nil }
+	selectPost := func(db *DB, ctx context.Context, id int) {
+		stmt := &Statement{Operation: OpSelect, Table: "posts", Fragment: "WHERE id = $id", Args: []any{id}}
+		_, err := db.execute(ctx, stmt, noop)
+		require.NoError(t, err)
+	}
+
+	t.Run("tracks select shapes within the scope", func(t *testing.T) {
+		db := &DB{}
+		ctx, scope := WithQueryScope(context.Background())
+
+		_, err := db.execute(ctx, &Statement{Operation: OpSelect, Table: "users", Fragment: "WHERE active = 1"}, noop)
+		require.NoError(t, err)
+		for id := range 3 {
+			selectPost(db, ctx, id)
+		}
+		_, err = db.execute(ctx, &Statement{Operation: OpDelete, Table: "posts", Fragment: "WHERE id = $id"}, noop)
+		require.NoError(t, err)
+		selectPost(db, context.Background(), 4)
+
+		require.Len(t, scope.Repeated(0), 2)
+
+		repeated := scope.Repeated(1)
+		require.Len(t, repeated, 1)
+		require.Equal(t, "posts", repeated[0].Table)
+		require.Equal(t, "WHERE id = $id", repeated[0].Fragment)
+		require.Equal(t, 3, repeated[0].Count)
+		require.Len(t, repeated[0].Stacks, 1, "executions from the same call site share a stack")
+		require.Contains(t, repeated[0].Stacks[0], "repeated_test.go:")
+		require.NotContains(t, repeated[0].Stacks[0], "/repeated.go:")
+
+		require.Empty(t, scope.Repeated(3))
+	})
+
+	t.Run("tells apart statements sharing a fragment", func(t *testing.T) {
+		db := &DB{}
+		ctx, scope := WithQueryScope(context.Background())
+
+		for id := range 2 {
+			for _, query := range []string{
+				"SELECT COUNT(*) FROM posts WHERE user_id = ?",
+				"SELECT EXISTS(SELECT 1 FROM posts WHERE user_id = ?)",
+				"SELECT `id`, `title` FROM posts WHERE user_id = ?",
+			} {
+				stmt := &Statement{Operation: OpSelect, Table: "posts", Fragment: "WHERE user_id = $id", SQL: query, Args: []any{id}}
+				_, err := db.execute(ctx, stmt, noop)
+				require.NoError(t, err)
+			}
+		}
+
+		repeated := scope.Repeated(1)
+		require.Len(t, repeated, 3)
+		require.Equal(t, 2, repeated[0].Count)
+		require.Equal(t, "SELECT COUNT(*) FROM posts WHERE user_id = ?", repeated[0].SQL)
+		require.Empty(t, scope.Repeated(2))
+	})
+
+	t.Run("reports once when the threshold is exceeded", func(t *testing.T) {
+		var reported []RepeatedQuery
+		db := &DB{
+			RepeatedQueryThreshold: 2,
+			OnRepeatedQuery: func(_ context.Context, query RepeatedQuery) {
+				reported = append(reported, query)
+			},
+		}
+		ctx, _ := WithQueryScope(context.Background())
+
+		for id := range 5 {
+			selectPost(db, ctx, id)
+		}
+
+		require.Len(t, reported, 1)
+		require.Equal(t, 3, reported[0].Count)
+	})
+
+	t.Run("asserts no repeated queries", func(t *testing.T) {
+		db := &DB{}
+		ctx, scope := WithQueryScope(context.Background())
+
+		selectPost(db, ctx, 1)
+		selectPost(db, ctx, 2)
+
+		recorder := &recordingT{}
+		require.True(t, AssertNoRepeatedQueries(recorder, scope, 2))
+		require.Empty(t, recorder.errors)
+
+		require.False(t, AssertNoRepeatedQueries(recorder, scope, 1))
+		require.Len(t, recorder.errors, 1)
+		require.Contains(t, recorder.errors[0], `SELECT from posts "WHERE id = $id" executed 2 times, more than 1, from:`)
+		require.Contains(t, recorder.errors[0], "repeated_test.go:")
+	})
+}
@@ -0,0 +1,125 @@
+package dbmap
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SlowQuery describes a statement that exceeded DB.SlowQueryThreshold.
+type SlowQuery struct {
+	// Statement is the slow statement. Its Fragment contains the query
+	// fragment with named parameters, as it was passed to DB.
+	Statement *Statement
+	// Duration is the time the database took to execute the statement.
+	Duration time.Duration
+	// Result is the result of the statement.
+	Result Result
+	// Err is the error returned by the statement, if any.
+	Err error
+	// Caller is the file:line that called DB, e.g. `app/users.go:42`. Empty
+	// when it can't be determined.
+	Caller string
+}
+
+// packageDir is the directory of dbmap's source files, used to skip dbmap's
+// own frames when finding the caller of a statement.
+var packageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// reportSlow wraps handler to report statements that take longer than
+// d.SlowQueryThreshold.
+func (d *DB) reportSlow(handler Handler) Handler {
+	return func(ctx context.Context, stmt *Statement) (Result, error) {
+		start := time.Now()
+		result, err := handler(ctx, stmt)
+		duration := stmt.elapsed(start)
+
+		if duration < d.SlowQueryThreshold {
+			return result, err
+		}
+
+		slow := SlowQuery{
+			Statement: stmt,
+			Duration:  duration,
+			Result:    result,
+			Err:       err,
+			Caller:    stmt.caller,
+		}
+		if d.OnSlowQuery != nil {
+			d.OnSlowQuery(ctx, slow)
+		} else {
+			d.logSlow(ctx, slow)
+		}
+
+		return result, err
+	}
+}
+
+// logSlow logs the slow statement at warn level using d.Logger, or
+// slog.Default when d.Logger is nil.
+func (d *DB) logSlow(ctx context.Context, slow SlowQuery) {
+	logger := d.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if !logger.Enabled(ctx, slog.LevelWarn) {
+		return
+	}
+
+	stmt := slow.Statement
+	attrs := []slog.Attr{slog.String("operation", string(stmt.Operation))}
+	if stmt.Table != "" {
+		attrs = append(attrs, slog.String("table", stmt.Table))
+	}
+	if stmt.Fragment != "" {
+		attrs = append(attrs, slog.String("fragment", stmt.Fragment))
+	}
+	attrs = append(attrs,
+		slog.String("sql", stmt.SQL),
+		slog.Duration("duration", slow.Duration),
+		slog.Duration("threshold", d.SlowQueryThreshold),
+	)
+	if slow.Caller != "" {
+		attrs = append(attrs, slog.String("caller", slow.Caller))
+	}
+	if len(stmt.NamedArgs) > 0 {
+		attrs = append(attrs, slog.Any("args", d.logArgs(stmt)))
+	}
+	if slow.Err != nil {
+		attrs = append(attrs, slog.Any("error", slow.Err))
+	}
+
+	logger.LogAttrs(ctx, slog.LevelWarn, "slow statement", attrs...)
+}
+
+// caller returns the file:line of the first frame outside of dbmap's
+// non-test source files, which is the code that called DB. It must be called
+// before the statement runs through the interceptors, whose frames would be
+// found first otherwise.
+func caller() string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+		if frame.File != "" && !isDBMapFrame(frame) {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// isDBMapFrame returns true for frames of dbmap's non-test source files.
+func isDBMapFrame(frame runtime.Frame) bool {
+	return filepath.Dir(frame.File) == packageDir && !strings.HasSuffix(frame.File, "_test.go")
+}
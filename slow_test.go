@@ -0,0 +1,130 @@
+package dbmap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDB_reportSlow(t *testing.T) {
+	slowHandler := func(context.Context, *Statement) (Result, error) {
+		time.Sleep(2 * time.Millisecond)
+		return Result{RowsReturned: 1}, nil
+	}
+
+	t.Run("calls OnSlowQuery for slow statements", func(t *testing.T) {
+		var reported []SlowQuery
+		db := &DB{
+			SlowQueryThreshold: time.Millisecond,
+			OnSlowQuery: func(_ context.Context, query SlowQuery) {
+				reported = append(reported, query)
+			},
+		}
+
+		stmt := &Statement{Operation: OpSelect, Fragment: "WHERE id = $id", SQL: "SELECT * FROM users WHERE id = ?"}
+		_, err := db.execute(context.Background(), stmt, slowHandler)
+		require.NoError(t, err)
+
+		require.Len(t, reported, 1)
+		require.Same(t, stmt, reported[0].Statement)
+		require.GreaterOrEqual(t, reported[0].Duration, 2*time.Millisecond)
+		require.Equal(t, Result{RowsReturned: 1}, reported[0].Result)
+		require.Contains(t, reported[0].Caller, "slow_test.go:")
+	})
+
+	t.Run("reports the caller of DB rather than interceptors", func(t *testing.T) {
+		var reported SlowQuery
+		db := &DB{
+			SlowQueryThreshold: time.Millisecond,
+			OnSlowQuery: func(_ context.Context, query SlowQuery) {
+				reported = query
+			},
+			Interceptors: []Interceptor{
+				func(ctx context.Context, stmt *Statement, next Handler) (Result, error) {
+					return next(ctx, stmt)
+				},
+			},
+		}
+
+		_, file, line, _ := runtime.Caller(0)
+		_, err := db.execute(context.Background(), &Statement{}, slowHandler)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("%s:%d", file, line+1), reported.Caller)
+	})
+
+	t.Run("excludes the time spent by SelectIter's caller", func(t *testing.T) {
+		db := &DB{
+			SlowQueryThreshold: 5 * time.Millisecond,
+			OnSlowQuery: func(context.Context, SlowQuery) {
+				t.Fatal("OnSlowQuery should not be called")
+			},
+		}
+
+		_, err := db.execute(context.Background(), &Statement{}, func(_ context.Context, stmt *Statement) (Result, error) {
+			start := time.Now()
+			time.Sleep(10 * time.Millisecond)
+			stmt.consumerTime += time.Since(start)
+			return Result{}, nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("ignores fast statements", func(t *testing.T) {
+		db := &DB{
+			SlowQueryThreshold: time.Minute,
+			OnSlowQuery: func(context.Context, SlowQuery) {
+				t.Fatal("OnSlowQuery should not be called")
+			},
+		}
+
+		_, err := db.execute(context.Background(), &Statement{}, slowHandler)
+		require.NoError(t, err)
+	})
+
+	t.Run("reports failed statements", func(t *testing.T) {
+		var reported SlowQuery
+		db := &DB{
+			SlowQueryThreshold: time.Millisecond,
+			OnSlowQuery: func(_ context.Context, query SlowQuery) {
+				reported = query
+			},
+		}
+
+		_, err := db.execute(context.Background(), &Statement{}, func(context.Context, *Statement) (Result, error) {
+			time.Sleep(2 * time.Millisecond)
+			return Result{}, errors.New("lock wait timeout")
+		})
+		require.EqualError(t, err, "lock wait timeout")
+		require.EqualError(t, reported.Err, "lock wait timeout")
+	})
+
+	t.Run("logs slow statements at warn level by default", func(t *testing.T) {
+		var buf bytes.Buffer
+		db := New(nil)
+		db.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+		db.SlowQueryThreshold = time.Millisecond
+
+		query, vars, err := db.bindQuery("WHERE id = $id", Args{"id": 1})
+		require.NoError(t, err)
+
+		_, err = db.execute(context.Background(), newStatement(OpRaw, nil, "WHERE id = $id", query, vars), slowHandler)
+		require.NoError(t, err)
+
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+		require.Equal(t, "WARN", entry["level"])
+		require.Equal(t, "slow statement", entry["msg"])
+		require.Equal(t, "WHERE id = $id", entry["fragment"])
+		require.Equal(t, "WHERE id = ?", entry["sql"])
+		require.Equal(t, map[string]any{"id": float64(1)}, entry["args"])
+		require.Contains(t, entry["caller"], "slow_test.go:")
+	})
+}
@@ -0,0 +1,146 @@
+package dbmap
+
+import (
+	"context"
+	"fmt"
+	"iter"
+)
+
+// Table provides type safe access to the table of T, returning values instead
+// of populating pointers. T must be a struct type.
+//
+//	users := dbmap.NewTable[User](db)
+//	user, err := users.Insert(ctx, User{Name: "Fox"})
+//	fmt.Println(user.ID)
+type Table[T any] struct {
+	db *DB
+}
+
+// NewTable returns a Table for T that executes statements using db.
+func NewTable[T any](db *DB) *Table[T] {
+	return &Table[T]{db: db}
+}
+
+// Find selects the record of type T with the given primary key, returning
+// ErrNotFound when no record is found.
+func Find[T any](ctx context.Context, d *DB, id any) (T, error) {
+	var record T
+
+	modelType, err := d.newModelType(&record)
+	if err != nil {
+		return record, fmt.Errorf("failed to find record: %w", err)
+	}
+
+	if len(modelType.primaryKey) != 1 {
+		return record, fmt.Errorf("failed to find record: %s must have a single primary key column", modelType.elemType.Name())
+	}
+
+	fragment := "WHERE " + d.dialect().Quote(modelType.primaryKey[0].name) + " = $id"
+	err = d.Select(ctx, &record, fragment, Args{"id": id})
+
+	return record, err
+}
+
+// One selects the first record of type T matching the query fragment,
+// returning ErrNotFound when no record is found.
+func One[T any](ctx context.Context, d *DB, queryFragment string, args any) (T, error) {
+	var record T
+	err := d.Select(ctx, &record, queryFragment, args)
+
+	return record, err
+}
+
+// All selects every record of type T matching the query fragment.
+func All[T any](ctx context.Context, d *DB, queryFragment string, args any) ([]T, error) {
+	var records []T
+	err := d.Select(ctx, &records, queryFragment, args)
+
+	return records, err
+}
+
+// Find selects the record with the given primary key. See Find.
+func (t *Table[T]) Find(ctx context.Context, id any) (T, error) {
+	return Find[T](ctx, t.db, id)
+}
+
+// One selects the first record matching the query fragment. See One.
+func (t *Table[T]) One(ctx context.Context, queryFragment string, args any) (T, error) {
+	return One[T](ctx, t.db, queryFragment, args)
+}
+
+// All selects every record matching the query fragment. See All.
+func (t *Table[T]) All(ctx context.Context, queryFragment string, args any) ([]T, error) {
+	return All[T](ctx, t.db, queryFragment, args)
+}
+
+// Iter streams every record matching the query fragment. See SelectIter.
+func (t *Table[T]) Iter(ctx context.Context, queryFragment string, args any) iter.Seq2[*T, error] {
+	return SelectIter[T](ctx, t.db, queryFragment, args)
+}
+
+// Insert inserts the record, returning a copy with the generated ID,
+// timestamps, and database defaults populated.
+func (t *Table[T]) Insert(ctx context.Context, record T) (T, error) {
+	err := t.db.InsertRecord(ctx, &record)
+
+	return record, err
+}
+
+// InsertAll inserts the records using multi-row INSERT statements, returning
+// a copy of the records with generated IDs and timestamps populated.
+func (t *Table[T]) InsertAll(ctx context.Context, records []T) ([]T, error) {
+	inserted := make([]T, len(records))
+	copy(inserted, records)
+
+	if err := t.db.InsertRecords(ctx, inserted); err != nil {
+		return nil, err
+	}
+
+	return inserted, nil
+}
+
+// Update updates the record's columns by primary key, returning a copy of the
+// record with the updates applied.
+func (t *Table[T]) Update(ctx context.Context, record T, updates Updates) (T, error) {
+	err := t.db.UpdateRecord(ctx, &record, updates)
+
+	return record, err
+}
+
+// UpdateWhere updates the rows matching the query fragment, returning the
+// number of rows affected.
+func (t *Table[T]) UpdateWhere(ctx context.Context, queryFragment string, args any, updates Updates) (int64, error) {
+	var model T
+	return t.db.Update(ctx, &model, queryFragment, args, updates)
+}
+
+// Delete deletes the record by primary key, returning the number of rows
+// affected.
+func (t *Table[T]) Delete(ctx context.Context, record T) (int64, error) {
+	return t.db.DeleteRecord(ctx, &record)
+}
+
+// DeleteAll deletes the records by primary key, returning the number of rows
+// affected.
+func (t *Table[T]) DeleteAll(ctx context.Context, records []T) (int64, error) {
+	return t.db.DeleteRecords(ctx, records)
+}
+
+// DeleteWhere deletes the rows matching the query fragment, returning the
+// number of rows affected.
+func (t *Table[T]) DeleteWhere(ctx context.Context, queryFragment string, args any) (int64, error) {
+	var model T
+	return t.db.Delete(ctx, &model, queryFragment, args)
+}
+
+// Exists returns true when a row matches the query fragment.
+func (t *Table[T]) Exists(ctx context.Context, queryFragment string, args any) (bool, error) {
+	var model T
+	return t.db.Exists(ctx, &model, queryFragment, args)
+}
+
+// Count returns the number of rows matching the query fragment.
+func (t *Table[T]) Count(ctx context.Context, queryFragment string, args any) (int64, error) {
+	var model T
+	return t.db.Count(ctx, &model, queryFragment, args)
+}
@@ -0,0 +1,30 @@
+package dbmap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFind_requiresSinglePrimaryKey(t *testing.T) {
+	type Membership struct {
+		TeamID int `db:"team_id,pk"`
+		UserID int `db:"user_id,pk"`
+	}
+
+	type Event struct {
+		Name string `db:"name"`
+	}
+
+	db := New(nil)
+
+	_, err := Find[Membership](context.Background(), db, 1)
+	require.EqualError(t, err, "failed to find record: Membership must have a single primary key column")
+
+	_, err = Find[Event](context.Background(), db, 1)
+	require.EqualError(t, err, "failed to find record: Event must have a single primary key column")
+
+	_, err = Find[int](context.Background(), db, 1)
+	require.ErrorIs(t, err, errInvalidType)
+}
@@ -0,0 +1,177 @@
+package dbmap
+
+import (
+	"context"
+	"maps"
+	"sync"
+)
+
+type (
+	// Tracer starts spans around the statements and transactions executed by
+	// DB, e.g. to integrate with a distributed tracing system.
+	Tracer interface {
+		// StartSpan starts a span for op with attrs, like AttrDBSystem and
+		// AttrStatement, returning a context carrying the span and a function
+		// ending it. Statements executed within a transaction are started
+		// with a context carrying the transaction's span, so it parents them.
+		StartSpan(ctx context.Context, op Operation, attrs map[string]any) (context.Context, EndSpan)
+	}
+
+	// EndSpan ends a span, adding attrs only known once the span ends, like
+	// AttrRowsAffected, and err when the span's operation failed.
+	EndSpan func(attrs map[string]any, err error)
+
+	// MemoryTracer is a Tracer recording spans in memory, so tests can assert
+	// on the statements and transactions executed by DB.
+	MemoryTracer struct {
+		mu    sync.Mutex
+		spans []*MemorySpan
+	}
+
+	// MemorySpan is a span recorded by MemoryTracer.
+	MemorySpan struct {
+		// Operation is the operation of the span, e.g. OpSelect.
+		Operation Operation
+		// Attributes are the attributes the span was started and ended with.
+		Attributes map[string]any
+		// Parent is the span that was active when the span was started, e.g.
+		// the span of the enclosing transaction.
+		Parent *MemorySpan
+		// Err is the error the span ended with.
+		Err error
+		// Ended is true once the span has ended.
+		Ended bool
+	}
+
+	// memorySpanContextKey is the context key of the active MemorySpan.
+	memorySpanContextKey struct{}
+
+	// parentContext is a context carrying the values of parent, like the
+	// span of a transaction, while keeping the deadline and cancellation of
+	// the embedded context.
+	parentContext struct {
+		context.Context
+		parent context.Context
+	}
+)
+
+const (
+	// OpTransaction is the operation of spans around Transaction and
+	// TransactionWithOptions. Statements never use it.
+	OpTransaction Operation = "transaction"
+
+	// AttrDBSystem is the dialect name, e.g. `mysql`.
+	AttrDBSystem = "db.system"
+	// AttrOperation is the operation of the span, e.g. `select`.
+	AttrOperation = "db.operation"
+	// AttrTable is the table of the statement's model.
+	AttrTable = "db.sql.table"
+	// AttrStatement is the SQL of the statement.
+	AttrStatement = "db.statement"
+	// AttrRowsAffected is the number of rows inserted, updated, or deleted.
+	AttrRowsAffected = "db.rows_affected"
+	// AttrRowsReturned is the number of rows read from the result set.
+	AttrRowsReturned = "db.rows_returned"
+	// AttrNested is true for spans of nested transactions, which use a
+	// savepoint.
+	AttrNested = "db.transaction.nested"
+)
+
+var _ Tracer = (*MemoryTracer)(nil)
+
+// traceStatement wraps handler to execute the statement within a span
+// started by d.Tracer.
+func (d *DB) traceStatement(handler Handler) Handler {
+	return func(ctx context.Context, stmt *Statement) (Result, error) {
+		attrs := map[string]any{
+			AttrDBSystem:  d.dialect().Name(),
+			AttrOperation: string(stmt.Operation),
+			AttrStatement: stmt.SQL,
+		}
+		if stmt.Table != "" {
+			attrs[AttrTable] = stmt.Table
+		}
+
+		ctx, end := d.Tracer.StartSpan(d.spanParent(ctx), stmt.Operation, attrs)
+		result, err := handler(ctx, stmt)
+		end(map[string]any{
+			AttrRowsAffected: result.RowsAffected,
+			AttrRowsReturned: result.RowsReturned,
+		}, err)
+
+		return result, err
+	}
+}
+
+// startTransactionSpan starts the span of a transaction, or of a savepoint
+// when nested, returning a function ending it. It is a no-op without a
+// Tracer.
+func (d *DB) startTransactionSpan(ctx context.Context, nested bool) (context.Context, EndSpan) {
+	if d.Tracer == nil {
+		return ctx, func(map[string]any, error) {}
+	}
+
+	attrs := map[string]any{
+		AttrDBSystem:  d.dialect().Name(),
+		AttrOperation: string(OpTransaction),
+	}
+	if nested {
+		attrs[AttrNested] = true
+	}
+
+	return d.Tracer.StartSpan(d.spanParent(ctx), OpTransaction, attrs)
+}
+
+// spanParent returns the context to start a span with, which carries the span
+// of d's transaction so it parents the statements executed within it.
+func (d *DB) spanParent(ctx context.Context) context.Context {
+	if d.tx == nil || d.tx.span == nil {
+		return ctx
+	}
+
+	return parentContext{Context: ctx, parent: d.tx.span}
+}
+
+func (c parentContext) Value(key any) any {
+	if value := c.parent.Value(key); value != nil {
+		return value
+	}
+
+	return c.Context.Value(key)
+}
+
+// StartSpan records a new span, parented to the MemorySpan carried by ctx.
+func (t *MemoryTracer) StartSpan(ctx context.Context, op Operation, attrs map[string]any) (context.Context, EndSpan) {
+	parent, _ := ctx.Value(memorySpanContextKey{}).(*MemorySpan)
+	span := &MemorySpan{Operation: op, Attributes: make(map[string]any, len(attrs)), Parent: parent}
+	maps.Copy(span.Attributes, attrs)
+
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+
+	return context.WithValue(ctx, memorySpanContextKey{}, span), func(attrs map[string]any, err error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		maps.Copy(span.Attributes, attrs)
+		span.Err = err
+		span.Ended = true
+	}
+}
+
+// Spans returns the recorded spans in the order they were started.
+func (t *MemoryTracer) Spans() []*MemorySpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]*MemorySpan(nil), t.spans...)
+}
+
+// Reset discards the recorded spans.
+func (t *MemoryTracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.spans = nil
+}
@@ -0,0 +1,96 @@
+package dbmap
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryTracer(t *testing.T) {
+	tracer := &MemoryTracer{}
+
+	ctx, endParent := tracer.StartSpan(context.Background(), OpTransaction, map[string]any{AttrDBSystem: "mysql"})
+	_, endChild := tracer.StartSpan(ctx, OpSelect, map[string]any{AttrTable: "users"})
+	endChild(map[string]any{AttrRowsReturned: int64(2)}, nil)
+	endParent(nil, errors.New("rolled back"))
+
+	spans := tracer.Spans()
+	require.Len(t, spans, 2)
+
+	require.Equal(t, OpTransaction, spans[0].Operation)
+	require.Nil(t, spans[0].Parent)
+	require.True(t, spans[0].Ended)
+	require.EqualError(t, spans[0].Err, "rolled back")
+
+	require.Same(t, spans[0], spans[1].Parent)
+	require.Equal(t, map[string]any{AttrTable: "users", AttrRowsReturned: int64(2)}, spans[1].Attributes)
+	require.NoError(t, spans[1].Err)
+
+	tracer.Reset()
+	require.Empty(t, tracer.Spans())
+}
+
+func TestDB_traceStatement(t *testing.T) {
+	t.Run("traces statements", func(t *testing.T) {
+		tracer := &MemoryTracer{}
+		db := &DB{Tracer: tracer, Dialect: PostgreSQL}
+
+		stmt := &Statement{Operation: OpDelete, Table: "users", SQL: "DELETE FROM users"}
+		_, err := db.execute(context.Background(), stmt, func(context.Context, *Statement) (Result, error) {
+			return Result{RowsAffected: 3}, nil
+		})
+		require.NoError(t, err)
+
+		spans := tracer.Spans()
+		require.Len(t, spans, 1)
+		require.Equal(t, OpDelete, spans[0].Operation)
+		require.Equal(t, map[string]any{
+			AttrDBSystem:     "postgresql",
+			AttrOperation:    "delete",
+			AttrTable:        "users",
+			AttrStatement:    "DELETE FROM users",
+			AttrRowsAffected: int64(3),
+			AttrRowsReturned: int64(0),
+		}, spans[0].Attributes)
+	})
+
+	t.Run("passes the span's context to the handler", func(t *testing.T) {
+		tracer := &MemoryTracer{}
+		db := &DB{Tracer: tracer}
+
+		var handlerSpan *MemorySpan
+		_, err := db.execute(context.Background(), &Statement{Operation: OpRaw}, func(ctx context.Context, _ *Statement) (Result, error) {
+			handlerSpan, _ = ctx.Value(memorySpanContextKey{}).(*MemorySpan)
+			return Result{}, errors.New("boom")
+		})
+		require.EqualError(t, err, "boom")
+
+		spans := tracer.Spans()
+		require.Len(t, spans, 1)
+		require.Same(t, spans[0], handlerSpan)
+		require.EqualError(t, spans[0].Err, "boom")
+	})
+
+	t.Run("parents statements to the transaction's span", func(t *testing.T) {
+		tracer := &MemoryTracer{}
+		txCtx, endTx := tracer.StartSpan(context.Background(), OpTransaction, nil)
+		db := &DB{Tracer: tracer, tx: &transaction{span: txCtx}}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		_, err := db.execute(ctx, &Statement{Operation: OpSelect}, func(ctx context.Context, _ *Statement) (Result, error) {
+			cancel()
+			require.ErrorIs(t, ctx.Err(), context.Canceled, "statements keep the caller's cancellation")
+			return Result{}, nil
+		})
+		require.NoError(t, err)
+		endTx(nil, nil)
+
+		spans := tracer.Spans()
+		require.Len(t, spans, 2)
+		require.Same(t, spans[0], spans[1].Parent)
+	})
+}
@@ -0,0 +1,401 @@
+package dbmap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoTransaction is returned by AfterCommit and AfterRollback when
+	// called on a DB that isn't in a transaction.
+	ErrNoTransaction = errors.New("not in a transaction")
+
+	// ErrExternalTransaction is returned by AfterCommit and AfterRollback when
+	// called on a DB whose transaction was created by NewFromTx or FromTx,
+	// since dbmap doesn't know when it commits or rolls back.
+	ErrExternalTransaction = errors.New("transaction is not managed by dbmap")
+)
+
+type (
+	// TxOptions configures a transaction started by TransactionWithOptions.
+	TxOptions struct {
+		// Isolation is the isolation level of the transaction. Defaults to the
+		// database's default isolation level.
+		Isolation sql.IsolationLevel
+		// ReadOnly starts a read-only transaction.
+		ReadOnly bool
+		// Retry re-runs the transaction when it fails with an error the
+		// dialect considers transient, like a deadlock. Retries are disabled
+		// when nil.
+		Retry *RetryPolicy
+	}
+
+	// RetryPolicy controls how often, and how quickly, a failed transaction is
+	// retried.
+	RetryPolicy struct {
+		// MaxAttempts is the maximum number of times the transaction is run,
+		// including the first attempt. Defaults to 3.
+		MaxAttempts int
+		// Backoff is the delay before the first retry, which doubles with each
+		// following retry. A random jitter of up to half the delay is
+		// subtracted so concurrent retries spread out. Defaults to 10ms.
+		Backoff time.Duration
+		// MaxBackoff caps the delay between retries. Defaults to 1s.
+		MaxBackoff time.Duration
+	}
+
+	// txContextKey is the context key of the DB stored by WithTx.
+	txContextKey struct{}
+
+	// transaction is the state of a transaction, or of a savepoint within
+	// one.
+	transaction struct {
+		// parent is the enclosing transaction of a savepoint.
+		parent *transaction
+		// source is the connection the transaction was started from, so
+		// only DBs using the same connection join it via the context.
+		source queryable
+		// external is true for transactions created by NewFromTx, which
+		// dbmap doesn't commit or roll back.
+		external bool
+		// span is the context carrying the transaction's span, see Tracer.
+		span context.Context
+
+		mu sync.Mutex
+		// savepoints counts the savepoints created within the outermost
+		// transaction, giving each a unique name.
+		savepoints    int
+		afterCommit   []func(ctx context.Context)
+		afterRollback []func(ctx context.Context, err error)
+	}
+)
+
+// Transaction executes the provided function within a database transaction. If
+// the function returns an error, the transaction is rolled back, otherwise it
+// is committed.
+//
+// Calling Transaction on the DB passed to fn creates a nested transaction
+// using a SAVEPOINT. When the nested function returns an error or panics, only
+// the changes made since the savepoint are rolled back.
+func (d *DB) Transaction(ctx context.Context, fn func(tx *DB) error) error {
+	return d.TransactionWithOptions(ctx, TxOptions{}, fn)
+}
+
+// TransactionWithOptions executes the provided function within a database
+// transaction like Transaction, using the isolation level, read-only flag, and
+// retry policy of opts.
+//
+// When retried, fn is called again with a new transaction, so it must not
+// hold on to state from a failed attempt.
+//
+// Nested transactions are part of the outer transaction, so opts are ignored
+// and they're never retried on their own. The outer transaction is retried
+// instead when it has a retry policy.
+func (d *DB) TransactionWithOptions(ctx context.Context, opts TxOptions, fn func(tx *DB) error) error {
+	d = d.contextDB(ctx)
+
+	if d.tx != nil {
+		return d.savepoint(ctx, fn)
+	}
+
+	if opts.Retry == nil {
+		return d.transaction(ctx, opts, fn)
+	}
+
+	maxAttempts := opts.Retry.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := d.transaction(ctx, opts, fn)
+		if err == nil || attempt >= maxAttempts || !d.dialect().Retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(opts.Retry.delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// transaction begins a new transaction and executes fn within it.
+func (d *DB) transaction(ctx context.Context, opts TxOptions, fn func(tx *DB) error) (err error) {
+	db, ok := d.db.(beginner)
+	if !ok {
+		return fmt.Errorf("transactions are not supported by %T", d.db)
+	}
+	spanCtx, endSpan := d.startTransactionSpan(ctx, false)
+	tx, err := db.BeginTx(spanCtx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		err = fmt.Errorf("failed to begin transaction: %w", err)
+		endSpan(nil, err)
+		return err
+	}
+
+	txDB := *d
+	txDB.db = tx
+	txDB.tx = &transaction{source: d.db}
+	if d.Tracer != nil {
+		txDB.tx.span = spanCtx
+	}
+
+	defer func() {
+		p := recover()
+		if p != nil {
+			err = fmt.Errorf("panic in transaction: %v", p)
+		}
+
+		committed := false
+		if err != nil {
+			_ = tx.Rollback()
+		} else if err = tx.Commit(); err != nil {
+			err = fmt.Errorf("failed to commit transaction: %w", d.translateError(err))
+		} else {
+			committed = true
+		}
+		endSpan(nil, err)
+
+		if committed {
+			txDB.tx.committed(ctx)
+		} else {
+			txDB.tx.rolledBack(ctx, err)
+		}
+		if p != nil {
+			panic(p)
+		}
+	}()
+
+	return fn(&txDB)
+}
+
+// savepoint executes fn within a SAVEPOINT of the current transaction, rolling
+// back to the savepoint if fn returns an error or panics and releasing it
+// otherwise.
+func (d *DB) savepoint(ctx context.Context, fn func(tx *DB) error) (err error) {
+	name := fmt.Sprintf("dbmap_savepoint_%d", d.tx.nextSavepoint())
+
+	spanCtx, endSpan := d.startTransactionSpan(ctx, true)
+	if _, err := d.db.ExecContext(spanCtx, "SAVEPOINT "+name); err != nil {
+		err = fmt.Errorf("failed to create savepoint: %w", err)
+		endSpan(nil, err)
+		return err
+	}
+
+	spDB := *d
+	spDB.tx = &transaction{parent: d.tx, source: d.tx.source}
+	if d.Tracer != nil {
+		spDB.tx.span = spanCtx
+	}
+
+	defer func() {
+		p := recover()
+		if p != nil {
+			err = fmt.Errorf("panic in transaction: %v", p)
+		}
+
+		released := false
+		if err != nil {
+			_, _ = d.db.ExecContext(spanCtx, "ROLLBACK TO SAVEPOINT "+name)
+		} else if _, err = d.db.ExecContext(spanCtx, "RELEASE SAVEPOINT "+name); err != nil {
+			err = fmt.Errorf("failed to release savepoint: %w", err)
+		} else {
+			released = true
+		}
+		endSpan(nil, err)
+
+		if released {
+			spDB.tx.released()
+		} else {
+			spDB.tx.rolledBack(ctx, err)
+		}
+		if p != nil {
+			panic(p)
+		}
+	}()
+
+	return fn(&spDB)
+}
+
+// AfterCommit registers fn to be called once the transaction commits, e.g. to
+// enqueue jobs that depend on the transaction's writes. Callbacks are called
+// in registration order.
+//
+// Callbacks registered in a nested transaction are promoted to the outer
+// transaction, so they're only called once the outermost transaction commits.
+// They're discarded when the nested transaction is rolled back.
+//
+// AfterCommit returns ErrNoTransaction when d isn't in a transaction, and
+// ErrExternalTransaction when its transaction was created by NewFromTx or
+// FromTx. fn isn't registered in either case.
+func (d *DB) AfterCommit(fn func(ctx context.Context)) error {
+	if err := d.callbackTransaction(); err != nil {
+		return fmt.Errorf("failed to register AfterCommit callback: %w", err)
+	}
+
+	d.tx.mu.Lock()
+	defer d.tx.mu.Unlock()
+	d.tx.afterCommit = append(d.tx.afterCommit, fn)
+
+	return nil
+}
+
+// AfterRollback registers fn to be called once the transaction is rolled back,
+// receiving the error that caused the rollback. Callbacks are called in
+// registration order.
+//
+// Callbacks registered in a nested transaction are called when it rolls back
+// to its savepoint, and are otherwise promoted to the outer transaction.
+//
+// AfterRollback returns ErrNoTransaction when d isn't in a transaction, and
+// ErrExternalTransaction when its transaction was created by NewFromTx or
+// FromTx. fn isn't registered in either case.
+func (d *DB) AfterRollback(fn func(ctx context.Context, err error)) error {
+	if err := d.callbackTransaction(); err != nil {
+		return fmt.Errorf("failed to register AfterRollback callback: %w", err)
+	}
+
+	d.tx.mu.Lock()
+	defer d.tx.mu.Unlock()
+	d.tx.afterRollback = append(d.tx.afterRollback, fn)
+
+	return nil
+}
+
+// InTransaction reports whether d executes statements within a transaction,
+// including one created by NewFromTx or FromTx.
+func (d *DB) InTransaction() bool {
+	return d.tx != nil
+}
+
+// callbackTransaction returns an error when callbacks can't be registered on
+// d's transaction.
+func (d *DB) callbackTransaction() error {
+	if d.tx == nil {
+		return ErrNoTransaction
+	}
+	if d.tx.root().external {
+		return ErrExternalTransaction
+	}
+
+	return nil
+}
+
+// WithTx returns a copy of ctx carrying the transactional DB tx. Methods called
+// on the DB the transaction was started from, using the returned context, are
+// executed within tx instead. This lets helpers that only receive the root DB
+// and a context join the active transaction.
+//
+//	err := db.Transaction(ctx, func(tx *dbmap.DB) error {
+//		ctx := dbmap.WithTx(ctx, tx)
+//		// Executes within tx, even though it is given db
+//		return db.InsertRecord(ctx, &user)
+//	})
+//
+// WithTx panics when tx isn't in a transaction.
+func WithTx(ctx context.Context, tx *DB) context.Context {
+	if tx.tx == nil {
+		panic("dbmap: WithTx called with a DB that isn't in a transaction")
+	}
+
+	return context.WithValue(ctx, txContextKey{}, tx)
+}
+
+// TxFromContext returns the transactional DB stored in ctx by WithTx.
+func TxFromContext(ctx context.Context) (*DB, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(*DB)
+	return tx, ok
+}
+
+// contextDB returns the transactional DB stored in ctx when it was started
+// from d, otherwise d. DBs already in a transaction always use their own
+// transaction.
+func (d *DB) contextDB(ctx context.Context) *DB {
+	if d.tx != nil {
+		return d
+	}
+
+	if tx, ok := TxFromContext(ctx); ok && tx.tx.source == d.db {
+		return tx
+	}
+
+	return d
+}
+
+// nextSavepoint returns a number for the next savepoint that is unique within
+// the outermost transaction.
+func (t *transaction) nextSavepoint() int {
+	root := t.root()
+
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	root.savepoints++
+
+	return root.savepoints
+}
+
+// root returns the outermost transaction.
+func (t *transaction) root() *transaction {
+	root := t
+	for root.parent != nil {
+		root = root.parent
+	}
+
+	return root
+}
+
+// committed calls the AfterCommit callbacks.
+func (t *transaction) committed(ctx context.Context) {
+	for _, fn := range t.afterCommit {
+		fn(ctx)
+	}
+}
+
+// rolledBack calls the AfterRollback callbacks.
+func (t *transaction) rolledBack(ctx context.Context, err error) {
+	for _, fn := range t.afterRollback {
+		fn(ctx, err)
+	}
+}
+
+// released promotes the callbacks of a savepoint to its parent transaction.
+func (t *transaction) released() {
+	t.parent.mu.Lock()
+	defer t.parent.mu.Unlock()
+
+	t.parent.afterCommit = append(t.parent.afterCommit, t.afterCommit...)
+	t.parent.afterRollback = append(t.parent.afterRollback, t.afterRollback...)
+}
+
+// delay returns how long to wait before the given retry, where the first
+// retry follows attempt 1.
+func (r *RetryPolicy) delay(attempt int) time.Duration {
+	backoff := r.Backoff
+	if backoff <= 0 {
+		backoff = 10 * time.Millisecond
+	}
+	maxBackoff := r.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = time.Second
+	}
+
+	delay := backoff
+	for range attempt - 1 {
+		if delay >= maxBackoff {
+			break
+		}
+		delay *= 2
+	}
+	delay = min(delay, maxBackoff)
+
+	return delay - rand.N(delay/2+1)
+}
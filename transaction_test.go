@@ -0,0 +1,82 @@
+package dbmap
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy_delay(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		attempt  int
+		expected time.Duration
+	}{
+		{name: "defaults first retry", policy: RetryPolicy{}, attempt: 1, expected: 10 * time.Millisecond},
+		{name: "defaults doubles", policy: RetryPolicy{}, attempt: 3, expected: 40 * time.Millisecond},
+		{name: "defaults capped", policy: RetryPolicy{}, attempt: 20, expected: time.Second},
+		{name: "custom backoff", policy: RetryPolicy{Backoff: time.Second, MaxBackoff: time.Minute}, attempt: 2, expected: 2 * time.Second},
+		{name: "custom max backoff", policy: RetryPolicy{Backoff: time.Second, MaxBackoff: 3 * time.Second}, attempt: 4, expected: 3 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				delay := tt.policy.delay(tt.attempt)
+				require.LessOrEqual(t, delay, tt.expected)
+				require.GreaterOrEqual(t, delay, tt.expected/2)
+			}
+		})
+	}
+}
+
+func TestDB_AfterCommit_outsideTransaction(t *testing.T) {
+	db := New(nil)
+	require.False(t, db.InTransaction())
+
+	err := db.AfterCommit(func(context.Context) {})
+	require.ErrorIs(t, err, ErrNoTransaction)
+	require.EqualError(t, err, "failed to register AfterCommit callback: not in a transaction")
+
+	err = db.AfterRollback(func(context.Context, error) {})
+	require.ErrorIs(t, err, ErrNoTransaction)
+
+	external := db.FromTx(&sql.Tx{})
+	require.True(t, external.InTransaction())
+	require.ErrorIs(t, external.AfterCommit(func(context.Context) {}), ErrExternalTransaction)
+	require.ErrorIs(t, external.AfterRollback(func(context.Context, error) {}), ErrExternalTransaction)
+}
+
+func TestDB_contextDB(t *testing.T) {
+	sqlDB, err := sql.Open("mysql", "root@/dbmap_test")
+	require.NoError(t, err)
+	otherSQLDB, err := sql.Open("mysql", "root@/dbmap_other")
+	require.NoError(t, err)
+
+	db := New(sqlDB)
+	otherDB := New(otherSQLDB)
+
+	tx := *db
+	tx.tx = &transaction{source: db.db}
+	ctx := WithTx(context.Background(), &tx)
+
+	found, ok := TxFromContext(ctx)
+	require.True(t, ok)
+	require.Same(t, &tx, found)
+
+	require.Same(t, &tx, db.contextDB(ctx), "the root DB should join the transaction")
+	require.Same(t, otherDB, otherDB.contextDB(ctx), "transactions from other connections should be ignored")
+	require.Same(t, db, db.contextDB(context.Background()))
+
+	otherTx := *db
+	otherTx.tx = &transaction{source: db.db}
+	require.Same(t, &otherTx, otherTx.contextDB(ctx), "transactional DBs should use their own transaction")
+
+	require.PanicsWithValue(t, "dbmap: WithTx called with a DB that isn't in a transaction", func() {
+		WithTx(context.Background(), db)
+	})
+}
@@ -0,0 +1,228 @@
+package dbmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type (
+	// Validator is implemented by models that validate themselves before
+	// being written by InsertRecord, InsertRecords, or UpdateRecord. Returning
+	// ValidationErrors, or a FieldError, merges them with the errors of the
+	// model's `validate` tags. Any other error is returned as is.
+	Validator interface {
+		Validate(ctx context.Context) error
+	}
+
+	// FieldError describes a field that failed validation.
+	FieldError struct {
+		// Field is the struct field name, e.g. `Email`.
+		Field string
+		// Column is the database column name, e.g. `email`.
+		Column string
+		// Rule is the failed rule, e.g. `required` or `max`.
+		Rule string
+		// Message describes the failure, e.g. `is required`.
+		Message string
+	}
+
+	// ValidationErrors is returned when a model fails validation, listing each
+	// failing field.
+	ValidationErrors []FieldError
+
+	// fieldRules are the rules of a column's `validate` tag.
+	fieldRules struct {
+		column column
+		rules  []rule
+	}
+
+	// rule is a single constraint of a `validate` tag, e.g. `max=255`.
+	rule struct {
+		name  string
+		limit float64
+	}
+)
+
+var validatorType = reflect.TypeFor[Validator]()
+
+func (e FieldError) Error() string {
+	return e.Column + " " + e.Message
+}
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldErr := range e {
+		messages = append(messages, fieldErr.Error())
+	}
+
+	return "validation failed: " + strings.Join(messages, ", ")
+}
+
+// parseValidations parses the `validate` tags of the columns, which contain a
+// comma separated list of rules:
+//
+//   - required: the value must not be the zero value.
+//   - min=N: strings must have at least N characters, slices and maps at
+//     least N items, and numbers must be at least N.
+//   - max=N: like min, but an upper bound.
+//
+// Nil pointers are skipped by min and max, so they can be combined with
+// required. Fields that aren't columns, like those tagged `db:"-"`, aren't
+// validated.
+func parseValidations(columns []column) ([]fieldRules, error) {
+	var validations []fieldRules
+
+	for _, col := range columns {
+		tag := col.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		rules := make([]rule, 0, strings.Count(tag, ",")+1)
+		for rawRule := range strings.SplitSeq(tag, ",") {
+			name, rawLimit, hasLimit := strings.Cut(strings.TrimSpace(rawRule), "=")
+
+			switch name {
+			case "required":
+				rules = append(rules, rule{name: name})
+			case "min", "max":
+				if !hasLimit {
+					return nil, fmt.Errorf("invalid validate tag on field %s: %s requires a limit, e.g. %s=10", col.Name, name, name)
+				}
+				limit, err := strconv.ParseFloat(rawLimit, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid validate tag on field %s: invalid %s limit %q", col.Name, name, rawLimit)
+				}
+				if !hasLength(col.Type) && !isNumber(col.Type) {
+					return nil, fmt.Errorf("invalid validate tag on field %s: %s is not supported for %s", col.Name, name, col.Type)
+				}
+				rules = append(rules, rule{name: name, limit: limit})
+			default:
+				return nil, fmt.Errorf("invalid validate tag on field %s: unknown rule %q", col.Name, name)
+			}
+		}
+
+		validations = append(validations, fieldRules{column: col, rules: rules})
+	}
+
+	return validations, nil
+}
+
+// validate checks the `validate` tags of the model and calls Validate if the
+// model implements Validator, returning ValidationErrors when any field is
+// invalid. value must be addressable.
+func (d *DB) validate(ctx context.Context, model *modelType, value reflect.Value) error {
+	var errs ValidationErrors
+
+	for _, field := range model.validations {
+		fieldValue := value.FieldByIndex(field.column.Index)
+
+		for _, r := range field.rules {
+			if message, ok := r.check(fieldValue); !ok {
+				errs = append(errs, FieldError{
+					Field:   field.column.Name,
+					Column:  field.column.name,
+					Rule:    r.name,
+					Message: message,
+				})
+			}
+		}
+	}
+
+	if model.implementsValidator {
+		if err := value.Addr().Interface().(Validator).Validate(d.hookContext(ctx)); err != nil {
+			var validationErrs ValidationErrors
+			var fieldErr FieldError
+
+			switch {
+			case errors.As(err, &validationErrs):
+				errs = append(errs, validationErrs...)
+			case errors.As(err, &fieldErr):
+				errs = append(errs, fieldErr)
+			default:
+				return err
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// check returns whether value satisfies the rule, and a message describing the
+// failure when it doesn't.
+func (r rule) check(value reflect.Value) (string, bool) {
+	if r.name == "required" {
+		return "is required", !value.IsZero()
+	}
+
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return "", true
+		}
+		value = value.Elem()
+	}
+
+	limit := strconv.FormatFloat(r.limit, 'f', -1, 64)
+
+	var actual float64
+	var unit string
+	switch value.Kind() {
+	case reflect.String:
+		actual = float64(utf8.RuneCountInString(value.String()))
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		actual = float64(value.Len())
+		unit = " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		actual = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		actual = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		actual = value.Float()
+	}
+
+	if r.name == "min" {
+		return "must be at least " + limit + unit, actual >= r.limit
+	}
+
+	return "must be at most " + limit + unit, actual <= r.limit
+}
+
+// hasLength returns true for types min and max compare by length.
+func hasLength(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	default:
+		return false
+	}
+}
+
+// isNumber returns true for types min and max compare by value.
+func isNumber(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
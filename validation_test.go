@@ -0,0 +1,152 @@
+package dbmap
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type validatedUser struct {
+	ID       int      `db:"id"`
+	Name     string   `db:"name" validate:"required,max=5"`
+	Email    string   `db:"email_address" validate:"required"`
+	Age      *int     `db:"age" validate:"min=18,max=130"`
+	Tags     []string `db:"tags" validate:"max=2"`
+	Password string   `db:"-" validate:"required"`
+}
+
+func (u *validatedUser) Validate(ctx context.Context) error {
+	switch u.Name {
+	case "admin":
+		return FieldError{Field: "Name", Column: "name", Rule: "reserved", Message: "is reserved"}
+	case "error":
+		return errors.New("validation unavailable")
+	default:
+		return nil
+	}
+}
+
+func TestDB_validate(t *testing.T) {
+	age := func(n int) *int { return &n }
+
+	tests := []struct {
+		name        string
+		user        validatedUser
+		expected    ValidationErrors
+		expectedErr string
+	}{
+		{
+			name: "valid",
+			user: validatedUser{Name: "Fox", Email: "fox@example.com", Age: age(32), Tags: []string{"a", "b"}},
+		},
+		{
+			name: "nil pointers are skipped by min and max",
+			user: validatedUser{Name: "Fox", Email: "fox@example.com"},
+		},
+		{
+			name: "invalid tags",
+			user: validatedUser{Name: "Mulder", Age: age(12), Tags: []string{"a", "b", "c"}},
+			expected: ValidationErrors{
+				{Field: "Name", Column: "name", Rule: "max", Message: "must be at most 5 characters"},
+				{Field: "Email", Column: "email_address", Rule: "required", Message: "is required"},
+				{Field: "Age", Column: "age", Rule: "min", Message: "must be at least 18"},
+				{Field: "Tags", Column: "tags", Rule: "max", Message: "must be at most 2 items"},
+			},
+		},
+		{
+			name: "counts characters instead of bytes",
+			user: validatedUser{Name: "Zoë🦊", Email: "zoe@example.com"},
+		},
+		{
+			name: "merges Validate errors",
+			user: validatedUser{Name: "admin"},
+			expected: ValidationErrors{
+				{Field: "Email", Column: "email_address", Rule: "required", Message: "is required"},
+				{Field: "Name", Column: "name", Rule: "reserved", Message: "is reserved"},
+			},
+		},
+		{
+			name:        "returns other Validate errors as is",
+			user:        validatedUser{Name: "error", Email: "error@example.com"},
+			expectedErr: "validation unavailable",
+		},
+	}
+
+	db := New(nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := db.newModelType(&tt.user)
+			require.NoError(t, err)
+
+			err = db.validate(context.Background(), model, reflect.ValueOf(&tt.user).Elem())
+
+			switch {
+			case tt.expectedErr != "":
+				require.EqualError(t, err, tt.expectedErr)
+			case tt.expected != nil:
+				var validationErrs ValidationErrors
+				require.ErrorAs(t, err, &validationErrs)
+				require.Equal(t, tt.expected, validationErrs)
+			default:
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidationErrors_Error(t *testing.T) {
+	err := ValidationErrors{
+		{Field: "Name", Column: "name", Rule: "required", Message: "is required"},
+		{Field: "Age", Column: "age", Rule: "min", Message: "must be at least 18"},
+	}
+
+	require.EqualError(t, err, "validation failed: name is required, age must be at least 18")
+}
+
+func TestParseValidations_invalidTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    any
+		expected string
+	}{
+		{
+			name: "unknown rule",
+			model: &struct {
+				Name string `validate:"email"`
+			}{},
+			expected: `invalid validate tag on field Name: unknown rule "email"`,
+		},
+		{
+			name: "missing limit",
+			model: &struct {
+				Name string `validate:"max"`
+			}{},
+			expected: "invalid validate tag on field Name: max requires a limit, e.g. max=10",
+		},
+		{
+			name: "invalid limit",
+			model: &struct {
+				Name string `validate:"min=ten"`
+			}{},
+			expected: `invalid validate tag on field Name: invalid min limit "ten"`,
+		},
+		{
+			name: "unsupported type",
+			model: &struct {
+				Active bool `validate:"max=1"`
+			}{},
+			expected: "invalid validate tag on field Active: max is not supported for bool",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newModelType(tt.model, defaultPluralizer)
+			require.EqualError(t, err, tt.expected)
+		})
+	}
+}